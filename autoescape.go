@@ -0,0 +1,871 @@
+// Copyright 2014 Joel Scoble (github:mohae). All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package rollie
+
+import (
+	"bytes"
+	"fmt"
+	"net/url"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/mohae/rollie/parse"
+)
+
+// Contextual escaping, like that of html/template, is done by the
+// ContextualEscaper. When a template that uses it is first rendered, the
+// text around its tags, and those of its partials, is read as HTML to find
+// the context of each escaped variable tag: element content, a quoted
+// attribute value, a URL, a string within JavaScript or CSS. Each tag is
+// escaped for its context. Tags in any other context, e.g. a tag or
+// attribute name, an unquoted attribute value or JavaScript code outside
+// of a string, are rejected, as are sections and partials that end in a
+// different context than they begin in, since they may be rendered any
+// number of times. Unescaped tags, {{{name}}} and {{&name}}, are written as
+// is and are assumed not to change the context. The text that lambdas
+// return is analyzed, when it is rendered, in the context of their tag, as
+// are the templates of the set again once any of them is redefined.
+//
+// The HTML is read leniently and simply: JavaScript regular expression
+// literals and template literals, for one, aren't understood.
+
+// ContextualEscaper escapes each variable for its context within an HTML
+// document. Templates that have variables in contexts that it can't escape
+// for fail to render. Its Escape method, which knows no context, escapes as
+// HTMLAposEscaper does; templates never call it.
+var ContextualEscaper Escaper = contextualEscaper{}
+
+type contextualEscaper struct{}
+
+func (contextualEscaper) Escape(s string) string {
+	return htmlAposReplacer.Replace(s)
+}
+
+// htmlState is the part of an HTML document that text is in.
+type htmlState uint8
+
+const (
+	stateText        htmlState = iota // element content
+	stateTagName                      // a tag's name
+	stateTag                          // in a tag, between attributes
+	stateAttrName                     // an attribute's name
+	stateAfterName                    // after an attribute's name
+	stateBeforeValue                  // after the = of an attribute
+	stateAttr                         // an attribute's value
+	stateRCDATA                       // the content of a textarea or title
+	stateScript                       // the content of a script
+	stateStyle                        // the content of a style
+	stateComment                      // an HTML comment
+	stateMixed                        // more than one context
+)
+
+// element is an element whose content isn't HTML.
+type element uint8
+
+const (
+	elementNone element = iota
+	elementScript
+	elementStyle
+	elementTextarea
+	elementTitle
+)
+
+var elementNames = map[string]element{
+	"script":   elementScript,
+	"style":    elementStyle,
+	"textarea": elementTextarea,
+	"title":    elementTitle,
+}
+
+// attrType is the kind of an attribute's value.
+type attrType uint8
+
+const (
+	attrNormal attrType = iota
+	attrURL
+	attrSrcset // a comma-separated list of URLs
+	attrJS
+	attrCSS
+	attrSrcdoc // an HTML document
+)
+
+// urlAttrs are the attributes whose values are URLs.
+var urlAttrs = map[string]bool{
+	"action":     true,
+	"archive":    true,
+	"background": true,
+	"cite":       true,
+	"classid":    true,
+	"codebase":   true,
+	"data":       true,
+	"dynsrc":     true,
+	"formaction": true,
+	"href":       true,
+	"icon":       true,
+	"itemtype":   true,
+	"longdesc":   true,
+	"lowsrc":     true,
+	"manifest":   true,
+	"ping":       true,
+	"poster":     true,
+	"profile":    true,
+	"src":        true,
+	"usemap":     true,
+}
+
+// attrTypeOf returns the kind of the named attribute's value. As in
+// html/template, a namespaced attribute, e.g. xlink:href, is of the kind of
+// its local name, as is a data- attribute of the rest of its name, and
+// unknown attributes whose names mention src, uri or url are URLs.
+func attrTypeOf(name string) attrType {
+	name = strings.ToLower(name)
+	if prefix, local, ok := strings.Cut(name, ":"); ok {
+		if prefix == "xmlns" {
+			return attrURL
+		}
+		name = local
+	}
+	name = strings.TrimPrefix(name, "data-")
+	switch {
+	case strings.HasPrefix(name, "on"):
+		return attrJS
+	case name == "style":
+		return attrCSS
+	case name == "srcset":
+		return attrSrcset
+	case name == "srcdoc":
+		return attrSrcdoc
+	case urlAttrs[name]:
+		return attrURL
+	case strings.Contains(name, "src"), strings.Contains(name, "uri"), strings.Contains(name, "url"):
+		return attrURL
+	}
+	return attrNormal
+}
+
+// delim is the delimiter of an attribute's value.
+type delim uint8
+
+const (
+	delimNone delim = iota
+	delimDouble
+	delimSingle
+	delimSpace // an unquoted value
+)
+
+// urlPart is the part of a URL that text is in.
+type urlPart uint8
+
+const (
+	urlStart urlPart = iota // nothing of the URL has been seen
+	urlPath                 // the scheme, host or path
+	urlQuery                // the query or fragment
+)
+
+// codeState is the part of JavaScript or CSS that text is in.
+type codeState uint8
+
+const (
+	codeText         codeState = iota // outside of strings and comments
+	codeDQ                            // a "string"
+	codeSQ                            // a 'string'
+	codeTemplate                      // a JavaScript `template literal`
+	codeLineComment                   // a JavaScript // comment
+	codeBlockComment                  // a /* comment */
+)
+
+// htmlContext is the context of a point in an HTML document.
+type htmlContext struct {
+	state   htmlState
+	element element // the element whose tag or content text is in
+	// name is the part of the name of a tag, with a / if it is an end
+	// tag, or of an attribute that has been read, while it is read.
+	name   string
+	attr   attrType
+	delim  delim
+	url    urlPart
+	code   codeState
+	escape bool // the previous character, in a string, was a backslash
+}
+
+func (c htmlContext) String() string {
+	switch c.state {
+	case stateTagName:
+		return "a tag name"
+	case stateTag, stateAfterName:
+		return "a tag"
+	case stateAttrName:
+		return "an attribute name"
+	case stateBeforeValue:
+		return "an unquoted attribute value"
+	case stateComment:
+		return "an HTML comment"
+	case stateMixed:
+		return "more than one context"
+	case stateAttr:
+		if c.delim == delimSpace {
+			return "an unquoted attribute value"
+		}
+		switch c.attr {
+		case attrSrcdoc:
+			return "an iframe srcdoc attribute"
+		case attrJS:
+			return "JavaScript " + c.code.String() + " in an attribute"
+		case attrCSS:
+			return "CSS " + c.code.String() + " in an attribute"
+		}
+		return "an attribute value"
+	case stateScript:
+		return "JavaScript " + c.code.String()
+	case stateStyle:
+		return "CSS " + c.code.String()
+	}
+	return "text"
+}
+
+func (c codeState) String() string {
+	switch c {
+	case codeDQ, codeSQ:
+		return "string"
+	case codeTemplate:
+		return "template literal"
+	case codeLineComment, codeBlockComment:
+		return "comment"
+	}
+	return "outside of a string"
+}
+
+// escKind is the escaping of a tag.
+type escKind uint8
+
+const (
+	escHTML escKind = iota // element content and attribute values
+	escURL
+	escURLPath
+	escURLQuery
+	escJSString
+	escCSSString
+)
+
+// escKinds are the escapers for each escKind. Element content and
+// attribute values are escaped alike, so that a partial may be used in
+// both.
+var escKinds = [...]Escaper{
+	escHTML:      HTMLAposEscaper,
+	escURL:       EscaperFunc(func(s string) string { return htmlAposReplacer.Replace(urlNormalize(urlFilter(s))) }),
+	escURLPath:   EscaperFunc(func(s string) string { return htmlAposReplacer.Replace(urlNormalize(s)) }),
+	escURLQuery:  EscaperFunc(func(s string) string { return htmlAposReplacer.Replace(url.QueryEscape(s)) }),
+	escJSString:  EscaperFunc(jsStringEscape),
+	escCSSString: EscaperFunc(cssStringEscape),
+}
+
+// escaping returns the escaping for a variable in context c and the context
+// after it. ok is false if the context is one that can't be escaped for.
+func (c htmlContext) escaping() (kind escKind, after htmlContext, ok bool) {
+	switch c.state {
+	case stateText, stateRCDATA:
+		return escHTML, c, true
+	case stateAttr:
+		if c.delim == delimSpace {
+			return 0, c, false
+		}
+		switch c.attr {
+		case attrSrcdoc:
+			return 0, c, false
+		case attrURL, attrSrcset:
+			switch c.url {
+			case urlStart:
+				c.url = urlPath
+				return escURL, c, true
+			case urlPath:
+				return escURLPath, c, true
+			}
+			return escURLQuery, c, true
+		case attrJS:
+			return escJSString, c, c.code == codeDQ || c.code == codeSQ
+		case attrCSS:
+			return escCSSString, c, c.code == codeDQ || c.code == codeSQ
+		}
+		return escHTML, c, true
+	case stateScript:
+		return escJSString, c, c.code == codeDQ || c.code == codeSQ
+	case stateStyle:
+		return escCSSString, c, c.code == codeDQ || c.code == codeSQ
+	}
+	return 0, c, false
+}
+
+// next returns the context after text.
+func (c htmlContext) next(text []byte) htmlContext {
+	for len(text) > 0 {
+		var n int
+		c, n = c.step(text)
+		text = text[n:]
+	}
+	return c
+}
+
+// step reads the start of s and returns the context after it and the
+// number of bytes read. Nothing is read only if the state changes.
+func (c htmlContext) step(s []byte) (htmlContext, int) {
+	switch c.state {
+	case stateText:
+		return c.stepText(s)
+	case stateTagName, stateAttrName:
+		// The name may be split by tags, e.g. comments.
+		n := 0
+		for n < len(s) && isNameByte(s[n]) {
+			n++
+		}
+		name := c.name + string(s[:n])
+		if n == len(s) {
+			c.name = name
+			return c, n
+		}
+		if c.state == stateTagName {
+			return startTag(name), n
+		}
+		return htmlContext{state: stateAfterName, element: c.element, attr: attrTypeOf(name)}, n
+	case stateTag:
+		return c.stepTag(s)
+	case stateAfterName:
+		switch {
+		case isSpace(s[0]):
+			return c, 1
+		case s[0] == '=':
+			c.state = stateBeforeValue
+			return c, 1
+		}
+		return htmlContext{state: stateTag, element: c.element}, 0
+	case stateBeforeValue:
+		switch s[0] {
+		case ' ', '\t', '\n', '\f', '\r':
+			return c, 1
+		case '"':
+			c.state, c.delim = stateAttr, delimDouble
+			return c, 1
+		case '\'':
+			c.state, c.delim = stateAttr, delimSingle
+			return c, 1
+		case '>':
+			return c.endTag(), 1
+		}
+		c.state, c.delim = stateAttr, delimSpace
+		return c, 0
+	case stateAttr:
+		return c.stepAttr(s)
+	case stateRCDATA:
+		name := "</textarea"
+		if c.element == elementTitle {
+			name = "</title"
+		}
+		if hasPrefixFold(s, name) {
+			return htmlContext{state: stateTag}, len(name)
+		}
+		return c, 1
+	case stateScript:
+		if hasPrefixFold(s, "</script") {
+			return htmlContext{state: stateTag}, len("</script")
+		}
+		return c.stepCode(s, true)
+	case stateStyle:
+		if hasPrefixFold(s, "</style") {
+			return htmlContext{state: stateTag}, len("</style")
+		}
+		return c.stepCode(s, false)
+	case stateComment:
+		if bytes.HasPrefix(s, []byte("-->")) {
+			return htmlContext{state: stateText}, 3
+		}
+		return c, 1
+	}
+	return c, len(s)
+}
+
+// stepText reads element content up to and including the name of a tag.
+func (c htmlContext) stepText(s []byte) (htmlContext, int) {
+	i := bytes.IndexByte(s, '<')
+	if i < 0 {
+		return c, len(s)
+	}
+	if i > 0 {
+		return c, i
+	}
+	if bytes.HasPrefix(s, []byte("<!--")) {
+		return htmlContext{state: stateComment}, 4
+	}
+	j := 1
+	if len(s) > 1 && s[1] == '/' {
+		j++
+	}
+	if j == len(s) {
+		// A tag's name may follow.
+		return htmlContext{state: stateTagName, name: string(s[1:j])}, j
+	}
+	if !isLetter(s[j]) {
+		return c, j
+	}
+	k := j
+	for k < len(s) && isNameByte(s[k]) {
+		k++
+	}
+	if k == len(s) {
+		return htmlContext{state: stateTagName, name: string(s[1:k])}, k
+	}
+	return startTag(string(s[1:k])), k
+}
+
+// startTag returns the context within a tag of the given name, which is
+// preceded by a / if it is an end tag.
+func startTag(name string) htmlContext {
+	c := htmlContext{state: stateTag}
+	if !strings.HasPrefix(name, "/") {
+		c.element = elementNames[strings.ToLower(name)]
+	}
+	return c
+}
+
+// stepTag reads the start of s within a tag, up to and including the name
+// of an attribute.
+func (c htmlContext) stepTag(s []byte) (htmlContext, int) {
+	switch {
+	case isSpace(s[0]) || s[0] == '/':
+		return c, 1
+	case s[0] == '>':
+		return c.endTag(), 1
+	}
+	n := 0
+	for n < len(s) && !isSpace(s[n]) && s[n] != '=' && s[n] != '>' && s[n] != '/' {
+		n++
+	}
+	if n == len(s) {
+		return htmlContext{state: stateAttrName, element: c.element, name: string(s)}, n
+	}
+	return htmlContext{state: stateAfterName, element: c.element, attr: attrTypeOf(string(s[:n]))}, n
+}
+
+// stepAttr reads the start of s within an attribute's value.
+func (c htmlContext) stepAttr(s []byte) (htmlContext, int) {
+	b := s[0]
+	switch {
+	case c.delim == delimDouble && b == '"',
+		c.delim == delimSingle && b == '\'',
+		c.delim == delimSpace && isSpace(b):
+		return htmlContext{state: stateTag, element: c.element}, 1
+	case c.delim == delimSpace && b == '>':
+		return c.endTag(), 1
+	}
+	switch c.attr {
+	case attrURL, attrSrcset:
+		switch {
+		case b == ',' && c.attr == attrSrcset:
+			c.url = urlStart
+		case isSpace(b) && c.url == urlStart:
+			// Space before a URL, or after it, before its descriptor.
+		case b == '?' || b == '#':
+			c.url = urlQuery
+		case c.url == urlStart:
+			c.url = urlPath
+		}
+	case attrJS:
+		return c.stepCode(s, true)
+	case attrCSS:
+		return c.stepCode(s, false)
+	}
+	return c, 1
+}
+
+// endTag returns the context after the > that ends a tag.
+func (c htmlContext) endTag() htmlContext {
+	switch c.element {
+	case elementScript:
+		return htmlContext{state: stateScript}
+	case elementStyle:
+		return htmlContext{state: stateStyle}
+	case elementTextarea, elementTitle:
+		return htmlContext{state: stateRCDATA, element: c.element}
+	}
+	return htmlContext{state: stateText}
+}
+
+// stepCode reads the start of s within JavaScript, if js is set, or CSS.
+func (c htmlContext) stepCode(s []byte, js bool) (htmlContext, int) {
+	b := s[0]
+	next := byte(0)
+	if len(s) > 1 {
+		next = s[1]
+	}
+	switch c.code {
+	case codeText:
+		switch {
+		case b == '"':
+			c.code = codeDQ
+		case b == '\'':
+			c.code = codeSQ
+		case b == '`' && js:
+			c.code = codeTemplate
+		case b == '/' && next == '/' && js:
+			c.code = codeLineComment
+			return c, 2
+		case b == '/' && next == '*':
+			c.code = codeBlockComment
+			return c, 2
+		}
+	case codeDQ, codeSQ, codeTemplate:
+		switch {
+		case c.escape:
+			c.escape = false
+		case b == '\\':
+			c.escape = true
+		case b == '"' && c.code == codeDQ, b == '\'' && c.code == codeSQ, b == '`' && c.code == codeTemplate:
+			c.code = codeText
+		case b == '\n' && c.code != codeTemplate:
+			// An unterminated string.
+			c.code = codeText
+		}
+	case codeLineComment:
+		if b == '\n' {
+			c.code = codeText
+		}
+	case codeBlockComment:
+		if b == '*' && next == '/' {
+			c.code = codeText
+			return c, 2
+		}
+	}
+	return c, 1
+}
+
+func isSpace(b byte) bool {
+	return b == ' ' || b == '\t' || b == '\n' || b == '\f' || b == '\r'
+}
+
+func isLetter(b byte) bool {
+	return 'a' <= b && b <= 'z' || 'A' <= b && b <= 'Z'
+}
+
+// isNameByte reports whether b may be part of a tag's or attribute's name.
+func isNameByte(b byte) bool {
+	return isLetter(b) || '0' <= b && b <= '9' || b == '-' || b == '_' || b == ':'
+}
+
+// hasPrefixFold reports whether s starts with prefix, ignoring case.
+func hasPrefixFold(s []byte, prefix string) bool {
+	return len(s) >= len(prefix) && strings.EqualFold(string(s[:len(prefix)]), prefix)
+}
+
+// escapes is the result of the analysis of a template's contexts: the
+// escapers of its escaped tags, and those of its partials, and the contexts
+// of the tags that may be lambdas, whose text is analyzed when it is
+// rendered. tree and gen are those of the template and its set when it was
+// analyzed.
+type escapes struct {
+	tree     *parse.Tree
+	gen      uint64
+	escapers map[parse.Node]Escaper
+	contexts map[parse.Node]htmlContext
+}
+
+// analysis holds the state of the analysis of a template's contexts.
+type analysis struct {
+	s        *state
+	kinds    map[parse.Node]escKind
+	contexts map[parse.Node]htmlContext
+	// ends holds the context at the end of each partial for the context
+	// at its start; inProgress the partials being analyzed, and whether
+	// their end context has been assumed to be their start context.
+	ends       map[partialKey]htmlContext
+	inProgress map[partialKey]bool
+	// blocks overriding those of the template being extended by a parent.
+	blocks map[string]block
+}
+
+type partialKey struct {
+	tree  *parse.Tree
+	start htmlContext
+}
+
+// contextEscapes returns the escapes of t, analyzing its contexts when it
+// is first rendered, and again if its tree is replaced or any template of
+// its set is defined, as that may change its partials.
+func (s *state) contextEscapes(t *Template) *escapes {
+	gen := t.gen.Load()
+	if e := t.escapes.Load(); e != nil && e.tree == t.Tree && e.gen == gen {
+		return e
+	}
+	a := newAnalysis(s)
+	a.list(htmlContext{}, t.Root)
+	e := a.escapes()
+	// Partials loaded by the analysis define templates, so the analysis
+	// is of the set as it was before them, and is done again next time.
+	e.tree, e.gen = t.Tree, gen
+	t.escapes.Store(e)
+	return e
+}
+
+// lambdaEscapes returns the escapes of tree, the text returned by the
+// lambda of node, which is analyzed in the context of node.
+func (s *state) lambdaEscapes(node parse.Node, tree *parse.Tree) *escapes {
+	c, ok := s.escapes.contexts[node]
+	if !ok {
+		s.errorf("%s has no escaping context", node)
+	}
+	a := newAnalysis(s)
+	a.blocks = s.blocks
+	a.list(c, tree.Root)
+	return a.escapes()
+}
+
+func newAnalysis(s *state) *analysis {
+	return &analysis{
+		s:          s,
+		kinds:      make(map[parse.Node]escKind),
+		contexts:   make(map[parse.Node]htmlContext),
+		ends:       make(map[partialKey]htmlContext),
+		inProgress: make(map[partialKey]bool),
+	}
+}
+
+// escapes returns the result of the analysis.
+func (a *analysis) escapes() *escapes {
+	e := &escapes{
+		escapers: make(map[parse.Node]Escaper, len(a.kinds)),
+		contexts: a.contexts,
+	}
+	for node, kind := range a.kinds {
+		e.escapers[node] = escKinds[kind]
+	}
+	return e
+}
+
+// list analyzes a list of nodes and returns the context after them.
+func (a *analysis) list(c htmlContext, list *parse.ListNode) htmlContext {
+	for _, node := range list.Nodes {
+		c = a.node(c, node)
+	}
+	return c
+}
+
+// node analyzes a node and returns the context after it.
+func (a *analysis) node(c htmlContext, node parse.Node) htmlContext {
+	switch node := node.(type) {
+	case *parse.TextNode:
+		return c.next(node.Text)
+	case *parse.SpaceNode:
+		return c.next(node.Text)
+	case *parse.CRNode:
+		return c.next(node.Text)
+	case *parse.NLNode:
+		return c.next(node.Text)
+	case *parse.VariableNode:
+		a.lambda(c, node)
+		if node.Escaped() {
+			return a.variable(c, node)
+		}
+	case *parse.DotNode:
+		a.lambda(c, node)
+		if node.Escaped() {
+			return a.variable(c, node)
+		}
+	case *parse.SectionNode:
+		a.lambda(c, node)
+		a.section(c, node, node.List)
+	case *parse.InvertedNode:
+		a.section(c, node, node.List)
+	case *parse.PartialNode:
+		return a.partial(c, node, node.Ident, nil)
+	case *parse.ParentNode:
+		return a.partial(c, node, node.Ident, node.Blocks())
+	case *parse.BlockNode:
+		if o, ok := a.blocks[node.Name]; ok {
+			name := a.s.name
+			a.s.name = o.name
+			defer func() { a.s.name = name }()
+			return a.list(c, o.list)
+		}
+		return a.list(c, node.List)
+	}
+	return c
+}
+
+// lambda records the context of a tag whose value may be a lambda. A tag
+// that is in more than one context is recorded as such, so that the text
+// of its lambdas can't be escaped.
+func (a *analysis) lambda(c htmlContext, node parse.Node) {
+	if prev, ok := a.contexts[node]; ok && prev != c {
+		c = htmlContext{state: stateMixed}
+	}
+	a.contexts[node] = c
+}
+
+// variable records the escaping of an escaped variable, or implicit
+// iterator, tag.
+func (a *analysis) variable(c htmlContext, node parse.Node) htmlContext {
+	kind, after, ok := c.escaping()
+	if !ok {
+		a.s.at(node)
+		a.s.errorf("%s is in %s, which can't be escaped", node, c)
+	}
+	if prev, ok := a.kinds[node]; ok && prev != kind {
+		a.s.at(node)
+		a.s.errorf("%s is in more than one context", node)
+	}
+	a.kinds[node] = kind
+	return after
+}
+
+// section analyzes the contents of a section, which must end in the
+// context they begin in.
+func (a *analysis) section(c htmlContext, node parse.Node, list *parse.ListNode) {
+	if end := a.list(c, list); end != c {
+		a.s.at(node)
+		a.s.errorf("%s ends in %s but begins in %s", node, end, c)
+	}
+}
+
+// partial analyzes a partial, or a parent with its blocks, and returns the
+// context after it. A partial that includes itself must end in the context
+// it begins in.
+func (a *analysis) partial(c htmlContext, node parse.Node, name string, blocks []*parse.BlockNode) htmlContext {
+	a.s.at(node)
+	tmpl := a.s.partial(name)
+	if tmpl == nil {
+		return c
+	}
+	old := a.blocks
+	if len(blocks) > 0 {
+		a.blocks = make(map[string]block, len(old)+len(blocks))
+		for name, b := range old {
+			a.blocks[name] = b
+		}
+		for _, b := range blocks {
+			if _, ok := a.blocks[b.Name]; !ok {
+				a.blocks[b.Name] = block{name: a.s.name, list: b.List}
+			}
+		}
+	}
+	oldName := a.s.name
+	defer func() { a.blocks, a.s.name = old, oldName }()
+	key := partialKey{tmpl.Tree, c}
+	// The blocks change what a parent renders.
+	memo := len(a.blocks) == 0
+	if end, ok := a.ends[key]; ok && memo {
+		return end
+	}
+	if _, ok := a.inProgress[key]; ok {
+		a.inProgress[key] = true
+		return c
+	}
+	a.inProgress[key] = false
+	a.s.name = tmpl.Name()
+	end := a.list(c, tmpl.Root)
+	a.s.name = oldName
+	if a.inProgress[key] && end != c {
+		a.s.at(node)
+		a.s.errorf("%s includes itself and ends in %s but begins in %s", node, end, c)
+	}
+	delete(a.inProgress, key)
+	if memo {
+		a.ends[key] = end
+	}
+	return end
+}
+
+// urlFilter replaces a URL whose scheme isn't http, https or mailto with a
+// harmless fragment, to keep out e.g. javascript: URLs.
+func urlFilter(s string) string {
+	if i := strings.IndexAny(s, ":/?#"); i >= 0 && s[i] == ':' {
+		switch strings.ToLower(s[:i]) {
+		case "http", "https", "mailto":
+		default:
+			return "#ZrollieZ"
+		}
+	}
+	return s
+}
+
+// urlNormalize percent-encodes the bytes that aren't allowed in a URL,
+// leaving its structure, and any existing escapes, intact.
+func urlNormalize(s string) string {
+	var b strings.Builder
+	last := 0
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if isLetter(c) || '0' <= c && c <= '9' || strings.IndexByte("-._~:/?#[]@!$&'()*+,;=%", c) >= 0 {
+			continue
+		}
+		b.WriteString(s[last:i])
+		fmt.Fprintf(&b, "%%%02X", c)
+		last = i + 1
+	}
+	if last == 0 {
+		return s
+	}
+	b.WriteString(s[last:])
+	return b.String()
+}
+
+// jsStringEscape escapes a value for use within a JavaScript string, in a
+// script or an attribute. Quotes and HTML's special characters are written
+// as Unicode escapes, so the value can't end the string, the attribute or
+// the script.
+func jsStringEscape(s string) string {
+	var b strings.Builder
+	last := 0
+	for i := 0; i < len(s); {
+		r, width := utf8.DecodeRuneInString(s[i:])
+		var esc string
+		switch {
+		case r == '\\':
+			esc = `\\`
+		case r == '\n':
+			esc = `\n`
+		case r == '\r':
+			esc = `\r`
+		case r == '\t':
+			esc = `\t`
+		case r < ' ' || strings.ContainsRune("'\"`<>&", r):
+			esc = `\u00` + string(hex[r>>4]) + string(hex[r&0xF])
+		case r == '\u2028':
+			esc = `\u2028`
+		case r == '\u2029':
+			esc = `\u2029`
+		}
+		if esc != "" {
+			b.WriteString(s[last:i])
+			b.WriteString(esc)
+			last = i + width
+		}
+		i += width
+	}
+	if last == 0 {
+		return s
+	}
+	b.WriteString(s[last:])
+	return b.String()
+}
+
+// cssStringEscape escapes a value for use within a CSS string, writing the
+// characters that could end the string, the attribute or the style as
+// hexadecimal escapes.
+func cssStringEscape(s string) string {
+	var b strings.Builder
+	last := 0
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c >= ' ' && strings.IndexByte("\"'\\<>&();{}/:+", c) < 0 {
+			continue
+		}
+		b.WriteString(s[last:i])
+		// The space ends the escape; it isn't part of the string.
+		fmt.Fprintf(&b, `\%x `, c)
+		last = i + 1
+	}
+	if last == 0 {
+		return s
+	}
+	b.WriteString(s[last:])
+	return b.String()
+}
@@ -0,0 +1,195 @@
+// Copyright 2014 Joel Scoble (github:mohae). All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package rollie
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+var contextualData = map[string]interface{}{
+	"v":     `<a href='x'>"&"</a>`,
+	"url":   "javascript:alert(1)",
+	"path":  "/a b/<c>",
+	"query": "a&b=c d",
+	"js":    "'); alert(\"x\"); </script>",
+	"css":   `"); color: red; /*`,
+	"list":  []string{"a'", "b<"},
+}
+
+var contextualTests = []struct {
+	name  string
+	input string
+	out   string
+}{
+	{"text", `<p>{{v}}</p>`, `<p>&lt;a href=&#39;x&#39;&gt;&quot;&amp;&quot;&lt;/a&gt;</p>`},
+	{"unescaped", `<p>{{{v}}}</p>`, `<p><a href='x'>"&"</a></p>`},
+	{"attr", `<p title="{{v}}">`, `<p title="&lt;a href=&#39;x&#39;&gt;&quot;&amp;&quot;&lt;/a&gt;">`},
+	{"single quoted attr", `<p title='{{v}}'>`, `<p title='&lt;a href=&#39;x&#39;&gt;&quot;&amp;&quot;&lt;/a&gt;'>`},
+	{"url filtered", `<a href="{{url}}">`, `<a href="#ZrollieZ">`},
+	{"url", `<a href="{{path}}">`, `<a href="/a%20b/%3Cc%3E">`},
+	{"url path", `<a href="http://x/{{path}}?q=1">`, `<a href="http://x//a%20b/%3Cc%3E?q=1">`},
+	{"url query", `<a href="/s?q={{query}}&amp;r={{query}}">`, `<a href="/s?q=a%26b%3Dc+d&amp;r=a%26b%3Dc+d">`},
+	{"url then path", `<img src="{{path}}/{{path}}">`, `<img src="/a%20b/%3Cc%3E//a%20b/%3Cc%3E">`},
+	{"script string", `<script>var s = "{{js}}";</script>`, `<script>var s = "\u0027); alert(\u0022x\u0022); \u003c/script\u003e";</script>`},
+	{"script single quoted", `<SCRIPT>f('{{js}}')</SCRIPT><p>{{v}}`, `<SCRIPT>f('\u0027); alert(\u0022x\u0022); \u003c/script\u003e')</SCRIPT><p>&lt;a href=&#39;x&#39;&gt;&quot;&amp;&quot;&lt;/a&gt;`},
+	{"script escaped quote", `<script>f("\"", "{{js}}")</script>`, `<script>f("\"", "\u0027); alert(\u0022x\u0022); \u003c/script\u003e")</script>`},
+	{"event", `<a onclick="f('{{js}}')">`, `<a onclick="f('\u0027); alert(\u0022x\u0022); \u003c/script\u003e')">`},
+	{"style string", `<style>p { font-family: "{{css}}" }</style>`, `<style>p { font-family: "\22 \29 \3b  color\3a  red\3b  \2f *" }</style>`},
+	{"style attr", `<p style="content: '{{css}}'">`, `<p style="content: '\22 \29 \3b  color\3a  red\3b  \2f *'">`},
+	{"textarea", `<textarea>{{v}}</textarea>`, `<textarea>&lt;a href=&#39;x&#39;&gt;&quot;&amp;&quot;&lt;/a&gt;</textarea>`},
+	{"comment in script", `<script>// it's
+var s = '{{js}}'; /* " */</script>`, "<script>// it's\nvar s = '\\u0027); alert(\\u0022x\\u0022); \\u003c/script\\u003e'; /* \" */</script>"},
+	{"section", `<ul>{{#list}}<li title="{{.}}">{{.}}</li>{{/list}}</ul>`, `<ul><li title="a&#39;">a&#39;</li><li title="b&lt;">b&lt;</li></ul>`},
+	{"section in attr", `<p class="{{#list}}{{.}} {{/list}}">`, `<p class="a&#39; b&lt; ">`},
+	{"partial", `<p title="{{>attr}}">{{>attr}}</p>`, `<p title="&lt;a href=&#39;x&#39;&gt;&quot;&amp;&quot;&lt;/a&gt;">&lt;a href=&#39;x&#39;&gt;&quot;&amp;&quot;&lt;/a&gt;</p>`},
+	{"object data", `<object data="{{url}}">`, `<object data="#ZrollieZ">`},
+	{"srcset", `<img srcset="{{url}}">`, `<img srcset="#ZrollieZ">`},
+	{"srcset list", `<img srcset="/a.png 1x, {{url}} 2x, {{path}}">`, `<img srcset="/a.png 1x, #ZrollieZ 2x, /a%20b/%3Cc%3E">`},
+	{"url after space", `<a href=" {{url}}">`, `<a href=" #ZrollieZ">`},
+	{"xlink:href", `<svg><a xlink:href="{{url}}">`, `<svg><a xlink:href="#ZrollieZ">`},
+	{"namespaced href", `<a foo:HREF="{{url}}">`, `<a foo:HREF="#ZrollieZ">`},
+	{"data attr", `<a data-src="{{url}}">`, `<a data-src="#ZrollieZ">`},
+	{"src in name", `<img lowsrc="{{url}}" imgurl="{{url}}">`, `<img lowsrc="#ZrollieZ" imgurl="#ZrollieZ">`},
+	{"split attr name", `<a hr{{!c}}ef="{{url}}">`, `<a href="#ZrollieZ">`},
+	{"split tag name", `<scr{{!c}}ipt>var s = '{{js}}'</script>`, `<script>var s = '\u0027); alert(\u0022x\u0022); \u003c/script\u003e'</script>`},
+}
+
+var contextualErrorTests = []struct {
+	name  string
+	input string
+	err   string
+}{
+	{"tag name", `<{{v}}>`, "{{v}} is in a tag name"},
+	{"in tag", `<p {{v}}>`, "{{v}} is in a tag"},
+	{"attr name", `<p data-{{v}}="1">`, "{{v}} is in an attribute name"},
+	{"unquoted", `<p title={{v}}>`, "{{v}} is in an unquoted attribute value"},
+	{"script code", `<script>var x = {{v}};</script>`, "{{v}} is in JavaScript outside of a string"},
+	{"template literal", "<script>`{{v}}`</script>", "{{v}} is in JavaScript template literal"},
+	{"event code", `<a onclick="f({{v}})">`, "{{v}} is in JavaScript outside of a string in an attribute"},
+	{"style code", `<style>p { color: {{v}} }</style>`, "{{v}} is in CSS outside of a string"},
+	{"comment", `<!-- {{v}} -->`, "{{v}} is in an HTML comment"},
+	{"section", `{{#list}}<p title="{{/list}}">`, "ends in an attribute value but begins in text"},
+	{"two contexts", `<script>"{{>partial}}"</script>{{>partial}}`, "{{v}} is in more than one context"},
+	{"srcdoc", `<iframe srcdoc="{{v}}">`, "{{v}} is in an iframe srcdoc attribute"},
+}
+
+func newContextual(t *testing.T, input string) *Template {
+	tmpl, err := New("page").Option("escape=contextual").Parse(input)
+	if err != nil {
+		t.Fatal(err)
+	}
+	Must(tmpl.New("attr").Parse(`{{v}}`))
+	Must(tmpl.New("partial").Parse(`{{v}}`))
+	return tmpl
+}
+
+func TestContextualEscaper(t *testing.T) {
+	for _, test := range contextualTests {
+		tmpl := newContextual(t, test.input)
+		// The second render uses the cached analysis.
+		for i := 0; i < 2; i++ {
+			var b bytes.Buffer
+			if err := tmpl.Render(&b, contextualData); err != nil {
+				t.Errorf("%s: %s", test.name, err)
+				break
+			}
+			if got := b.String(); got != test.out {
+				t.Errorf("%s: expected\n\t%s\ngot\n\t%s", test.name, test.out, got)
+				break
+			}
+		}
+	}
+}
+
+func TestContextualEscaperErrors(t *testing.T) {
+	for _, test := range contextualErrorTests {
+		err := newContextual(t, test.input).Render(new(bytes.Buffer), contextualData)
+		if err == nil {
+			t.Errorf("%s: expected error; got none", test.name)
+			continue
+		}
+		if !strings.Contains(err.Error(), test.err) {
+			t.Errorf("%s: expected error containing %q; got %q", test.name, test.err, err)
+		}
+	}
+}
+
+func TestContextualEscaperErrorLocation(t *testing.T) {
+	tmpl := newContextual(t, "<p>\n{{>tag}}")
+	Must(tmpl.New("tag").Parse("<p>\n<p {{v}}>"))
+	err := tmpl.Render(new(bytes.Buffer), contextualData)
+	want := "rollie: tag:2: {{v}} is in a tag, which can't be escaped"
+	if err == nil || err.Error() != want {
+		t.Errorf("expected error %q, got %v", want, err)
+	}
+}
+
+// TestContextualEscaperRedefined checks that redefining a partial has the
+// templates that include it analyzed again, in the set and in clones.
+func TestContextualEscaperRedefined(t *testing.T) {
+	want := `<script>f('\u0027;alert(1);//')</script>`
+	data := map[string]string{"v": "';alert(1);//"}
+	tmpl := Must(New("page").Option("escape=contextual").Parse(`<script>f('{{>p}}')</script>`))
+	Must(tmpl.New("p").Parse(`x`))
+	testRender(t, tmpl, data, `<script>f('x')</script>`)
+	clone := Must(tmpl.Clone())
+	Must(tmpl.New("p").Parse(`{{v}}`))
+	testRender(t, tmpl, data, want)
+	testRender(t, clone, data, `<script>f('x')</script>`)
+	Must(clone.New("p").Parse(`{{v}}`))
+	testRender(t, clone, data, want)
+	if _, err := clone.AddParseTree("p", Must(New("p").Parse(`{{{v}}}`)).Tree); err != nil {
+		t.Fatal(err)
+	}
+	testRender(t, clone, data, `<script>f('';alert(1);//')</script>`)
+}
+
+func TestContextualEscaperLambda(t *testing.T) {
+	data := map[string]interface{}{
+		"js":  contextualData["js"],
+		"v":   contextualData["v"],
+		"url": contextualData["url"],
+		"section": func(text string, render func(string) string) string {
+			return render(text)
+		},
+		"inject": func(text string, render func(string) string) string {
+			return render("{{v}}")
+		},
+		"link": func() string { return "{{url}}" },
+		"tag":  func() string { return "{{v}}" },
+	}
+	tmpl := newContextual(t, `<script>f('{{#section}}{{js}}{{/section}}')</script><a href="{{link}}">`)
+	testRender(t, tmpl, data, `<script>f('\u0027); alert(\u0022x\u0022); \u003c/script\u003e')</script><a href="#ZrollieZ">`)
+	for _, test := range []struct{ input, err string }{
+		{`<p title={{#inject}}{{/inject}}>`, "{{v}} is in an unquoted attribute value"},
+		{`<p {{&tag}}>`, "{{v}} is in a tag"},
+		{`<p title="{{>lambda}}">{{>lambda}}`, "{{v}} is in more than one context"},
+	} {
+		tmpl := newContextual(t, test.input)
+		Must(tmpl.New("lambda").Parse(`{{{tag}}}`))
+		err := tmpl.Render(new(bytes.Buffer), data)
+		if err == nil || !strings.Contains(err.Error(), test.err) {
+			t.Errorf("%s: expected error containing %q, got %v", test.input, test.err, err)
+		}
+	}
+}
+
+func TestContextualEscaperRecursive(t *testing.T) {
+	tmpl := Must(New("tree").Escaper(ContextualEscaper).Parse(`<li title="{{name}}">{{name}}<ul>{{#kids}}{{>tree}}{{/kids}}</ul></li>`))
+	data := map[string]interface{}{
+		"name": "a<",
+		"kids": []map[string]interface{}{{"name": `b"`, "kids": false}},
+	}
+	var b bytes.Buffer
+	if err := tmpl.Render(&b, data); err != nil {
+		t.Fatal(err)
+	}
+	want := `<li title="a&lt;">a&lt;<ul><li title="b&quot;">b&quot;<ul></ul></li></ul></li>`
+	if got := b.String(); got != want {
+		t.Errorf("expected %q, got %q", want, got)
+	}
+}
@@ -0,0 +1,1231 @@
+// Copyright 2014 Joel Scoble (github:mohae). All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"go/format"
+	"go/token"
+	"go/types"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/mohae/rollie"
+	"github.com/mohae/rollie/parse"
+)
+
+// stringList is a flag that may be repeated.
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *stringList) Set(s string) error {
+	*l = append(*l, s)
+	return nil
+}
+
+// runGen runs the gen command with its arguments.
+func runGen(args []string) error {
+	flags := flag.NewFlagSet("gen", flag.ExitOnError)
+	out := flags.String("o", "", "file to write; the default is standard output")
+	prefix := flags.String("prefix", "Render", "prefix of the render functions' names")
+	typ := flags.String("type", "", "type of the render functions' data, e.g. *Page")
+	var options stringList
+	flags.Var(&options, "option", "option of the templates, e.g. missingkey=error; may be repeated")
+	flags.Parse(args)
+	if *typ == "" {
+		return errors.New("gen: no data type; use -type")
+	}
+	filenames, err := expand(flags.Args())
+	if err != nil {
+		return err
+	}
+	var templates []*template
+	for _, filename := range filenames {
+		tmpl, err := readTemplate(filename)
+		if err != nil {
+			return err
+		}
+		templates = append(templates, tmpl)
+	}
+	dir := "."
+	if *out != "" {
+		dir = filepath.Dir(*out)
+	}
+	pkg, err := loadPackage(dir, *out)
+	if err != nil {
+		return err
+	}
+	data, err := dataType(pkg, *typ)
+	if err != nil {
+		return err
+	}
+	src, err := generate(&config{
+		cmd:     "rollie gen " + strings.Join(args, " "),
+		pkg:     pkg,
+		prefix:  *prefix,
+		data:    data,
+		options: options,
+	}, templates)
+	if err != nil {
+		return err
+	}
+	if *out == "" {
+		_, err = os.Stdout.Write(src)
+		return err
+	}
+	return os.WriteFile(*out, src, 0666)
+}
+
+// expand returns the files matched by the patterns. go generate doesn't
+// expand globs, so gen does.
+func expand(patterns []string) ([]string, error) {
+	if len(patterns) == 0 {
+		return nil, errors.New("gen: no template files")
+	}
+	var filenames []string
+	for _, pattern := range patterns {
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, err
+		}
+		if len(matches) == 0 {
+			return nil, fmt.Errorf("gen: pattern matches no files: %#q", pattern)
+		}
+		filenames = append(filenames, matches...)
+	}
+	return filenames, nil
+}
+
+// template is a parsed template file.
+type template struct {
+	name     string // the template's name: the file's base name without its extension
+	filename string
+	tree     *parse.Tree
+}
+
+// readTemplate reads and parses the named file.
+func readTemplate(filename string) (*template, error) {
+	b, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	name := filepath.Base(filename)
+	name = strings.TrimSuffix(name, filepath.Ext(name))
+	tree, err := parse.ParseBytes(name, b, "", "")
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", filename, err)
+	}
+	return &template{name: name, filename: filename, tree: tree}, nil
+}
+
+// config is what is generated: the render functions, of the templates,
+// for data of a type in a package, and the options they are rendered with.
+type config struct {
+	cmd     string // the command recorded in the file's header
+	pkg     *types.Package
+	prefix  string
+	data    types.Type
+	options []string
+}
+
+// generator holds the state of the generation of a Go file.
+type generator struct {
+	pkg     *types.Package
+	prefix  string
+	tmpl    map[string]*template
+	imports map[string]string     // the names of the imported packages by their paths
+	names   map[string]bool       // the names declared by the file
+	funcs   map[string]*recursion // the render functions of recursive partials, see recurse
+	decls   bytes.Buffer          // the declarations that follow the render functions
+	fn      *function             // the function being generated
+	n       int                   // the number of local names made
+	tag     string                // the tag being generated, for errors
+}
+
+// function is the state of the generation of a function.
+type function struct {
+	buf    *bytes.Buffer
+	inline []include // the templates being generated, the innermost last
+	files  []string  // the templates the code being generated is from, the innermost last
+	// blocks overriding those of the template being inlined by a parent.
+	blocks map[string]block
+	text   []byte  // text that hasn't been written yet
+	frames []frame // the context stack; the top is the last element
+	loops  []loop  // the list sections being iterated; the innermost is last
+	rec    *recursion
+	depth  int // the number of render functions of recursive partials it is within
+}
+
+// include is a template being generated and the number of contexts it was
+// included with.
+type include struct {
+	name   string
+	frames int
+}
+
+// block is a block that overrides another and the template it is in.
+type block struct {
+	node *parse.BlockNode
+	tmpl string
+}
+
+// loop is an iteration over a list section: the expressions of the 0-based
+// index of the element and the length of the list, and, in the render
+// function of a recursive partial, the condition under which there is one.
+type loop struct {
+	index, len string
+	in         string
+}
+
+// frame is a context of the stack: a value, or the contexts pushed by each
+// include of a recursive partial.
+type frame struct {
+	v      value
+	levels *levels
+}
+
+// levels is a parameter of the render function of a recursive partial:
+// the contexts pushed between each include of the partial and the next,
+// whose last element is on top of the stack.
+type levels struct {
+	expr   string
+	typ    string  // the name of the Go type of an element
+	fields []value // the contexts of an element, bottom first, by their field names
+}
+
+// recursion is the render function of a partial that includes itself.
+type recursion struct {
+	name   string
+	params int // the number of contexts it is passed, not counting its levels
+	level  *levels
+}
+
+// maxRecursion is the most render functions of recursive partials that
+// one may be within.
+const maxRecursion = 4
+
+// genError is the wrapper type of the errors of a generation, which are
+// raised with panic.
+type genError struct {
+	err error
+}
+
+// generate returns the formatted source of a Go file, in the package of
+// c, with a render function for each of the templates.
+func generate(c *config, templates []*template) (src []byte, err error) {
+	g := &generator{
+		pkg:    c.pkg,
+		prefix: c.prefix,
+		tmpl:   make(map[string]*template),
+		imports: map[string]string{
+			"io":                      "io",
+			"github.com/mohae/rollie": "rollie",
+		},
+		names: make(map[string]bool),
+		funcs: make(map[string]*recursion),
+	}
+	options := c.prefix + "Options"
+	if !token.IsIdentifier(options) || !token.IsExported(options) {
+		return nil, fmt.Errorf("gen: can't make an exported Go name from %q", options)
+	}
+	exported := map[string]string{options: ""}
+	for _, t := range templates {
+		if _, ok := g.tmpl[t.name]; ok {
+			return nil, fmt.Errorf("gen: %s: duplicate template name %q", t.filename, t.name)
+		}
+		name := c.prefix + goName(t.name)
+		if !token.IsIdentifier(name) || !token.IsExported(name) {
+			return nil, fmt.Errorf("gen: %s: can't make an exported Go name from %q", t.filename, c.prefix+t.name)
+		}
+		if other, ok := exported[name]; ok {
+			if name == options {
+				return nil, fmt.Errorf("gen: %s: template %q is rendered by %s, the name of the options", t.filename, t.name, name)
+			}
+			return nil, fmt.Errorf("gen: %s: templates %q and %q are both rendered by %s", t.filename, other, t.name, name)
+		}
+		exported[name] = t.name
+		g.tmpl[t.name] = t
+		g.names[name] = true
+	}
+	g.names[options] = true
+	if err := checkOptions(c.options); err != nil {
+		return nil, err
+	}
+	defer func() {
+		if e := recover(); e != nil {
+			ge, ok := e.(genError)
+			if !ok {
+				panic(e)
+			}
+			src, err = nil, ge.err
+		}
+	}()
+	var body bytes.Buffer
+	data := g.typeName(c.data)
+	for _, t := range templates {
+		name := c.prefix + goName(t.name)
+		fmt.Fprintf(&body, "\n// %s renders the %s template, from %s, with data to w.\n", name, t.name, filepath.ToSlash(t.filename))
+		fmt.Fprintf(&body, "func %s(w io.Writer, data %s) error {\n", name, data)
+		fmt.Fprintf(&body, "return rollie.Run(%s, %q, w, func(c *rollie.Context) {\n", options, t.name)
+		g.fn = &function{
+			buf:    &body,
+			inline: []include{{t.name, 1}},
+			files:  []string{t.name},
+			frames: []frame{{v: value{expr: "data", typ: c.data}}},
+		}
+		g.list(t.tree.Root)
+		body.WriteString("})\n}\n")
+	}
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "// Code generated by %q; DO NOT EDIT.\n\n", c.cmd)
+	fmt.Fprintf(&b, "package %s\n\n", c.pkg.Name())
+	g.writeImports(&b)
+	fmt.Fprintf(&b, "\n// %s holds the options and the escaper of the render functions, see\n", options)
+	b.WriteString("// rollie.Template.Option and rollie.Template.Escaper. Its options are\n")
+	b.WriteString("// those that the file was generated with; they may be changed before the\n")
+	b.WriteString("// functions are called.\n")
+	fmt.Fprintf(&b, "var %s = rollie.New(%q)", options, c.prefix)
+	if len(c.options) > 0 {
+		fmt.Fprintf(&b, ".Option(%s)", quoteList(c.options))
+	}
+	b.WriteString("\n")
+	b.Write(body.Bytes())
+	b.Write(g.decls.Bytes())
+	src, err = format.Source(b.Bytes())
+	if err != nil {
+		// The generated code is wrong, not the templates.
+		return nil, fmt.Errorf("gen: internal error: %v", err)
+	}
+	return src, nil
+}
+
+// checkOptions returns an error if the options aren't valid for rollie's
+// Template.Option, or can't be used by generated code.
+func checkOptions(options []string) (err error) {
+	defer func() {
+		if e := recover(); e != nil {
+			err = fmt.Errorf("gen: %v", e)
+		}
+	}()
+	rollie.New("gen").Option(options...)
+	for _, opt := range options {
+		if opt == "escape=contextual" {
+			return errors.New("gen: generated code can't be escaped by the ContextualEscaper")
+		}
+	}
+	return nil
+}
+
+// writeImports writes the import declaration of the packages the code
+// refers to, the standard library's first.
+func (g *generator) writeImports(b *bytes.Buffer) {
+	var std, other []string
+	for path := range g.imports {
+		if first, _, _ := strings.Cut(path, "/"); strings.Contains(first, ".") {
+			other = append(other, path)
+		} else {
+			std = append(std, path)
+		}
+	}
+	sort.Strings(std)
+	sort.Strings(other)
+	b.WriteString("import (\n")
+	for i, paths := range [][]string{std, other} {
+		if i > 0 && len(std) > 0 {
+			b.WriteString("\n")
+		}
+		for _, path := range paths {
+			name := g.imports[path]
+			if name == filepath.Base(path) || path == "fmt" || path == "io" || path == "strconv" {
+				fmt.Fprintf(b, "\t%q\n", path)
+			} else {
+				fmt.Fprintf(b, "\t%s %q\n", name, path)
+			}
+		}
+	}
+	b.WriteString(")\n")
+}
+
+// use records that the code refers to a package of the standard library.
+func (g *generator) use(path string) {
+	g.imports[path] = path
+}
+
+// localName matches the names of the generated code's variables and
+// parameters, which imported packages mustn't be named.
+var localName = regexp.MustCompile(`^([a-z]+[0-9]+|c|w|data|levels|li|ln|ok)$`)
+
+// typeName returns the name of typ in the generated code, importing the
+// packages it refers to.
+func (g *generator) typeName(typ types.Type) string {
+	return types.TypeString(typ, func(p *types.Package) string {
+		if p == g.pkg {
+			return ""
+		}
+		if name, ok := g.imports[p.Path()]; ok {
+			return name
+		}
+		name := p.Name()
+		for i := 2; localName.MatchString(name) || g.imported(name); i++ {
+			name = fmt.Sprintf("%s%s", p.Name(), strings.Repeat("_", i-1))
+		}
+		g.imports[p.Path()] = name
+		return name
+	})
+}
+
+// imported reports whether a package is imported with the name.
+func (g *generator) imported(name string) bool {
+	for _, n := range g.imports {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
+
+// local returns a new name for a variable or label.
+func (g *generator) local(prefix string) string {
+	g.n++
+	return prefix + strconv.Itoa(g.n)
+}
+
+// unique returns name, or, if the file already declares it, name followed
+// by a number, and declares it.
+func (g *generator) unique(name string) string {
+	n := name
+	for i := 2; g.names[n]; i++ {
+		n = name + strconv.Itoa(i)
+	}
+	g.names[n] = true
+	return n
+}
+
+// printf writes code to the function being generated.
+func (g *generator) printf(format string, args ...interface{}) {
+	fmt.Fprintf(g.fn.buf, format, args...)
+}
+
+// errorf raises an error in the template being generated.
+func (g *generator) errorf(line int, format string, args ...interface{}) {
+	files := g.fn.files
+	t := g.tmpl[files[len(files)-1]]
+	panic(genError{fmt.Errorf("gen: %s:%d: "+format, append([]interface{}{t.filename, line}, args...)...)})
+}
+
+// list generates the code for a list of nodes. Runs of text, up to and
+// including a newline, are written at once.
+func (g *generator) list(list *parse.ListNode) {
+	g.nodes(list)
+	g.flush(false)
+}
+
+// nodes generates the code for the nodes of a list, leaving any text at the
+// end pending. The contents of blocks are part of the list they are in.
+func (g *generator) nodes(list *parse.ListNode) {
+	fn := g.fn
+	for _, node := range list.Nodes {
+		switch node := node.(type) {
+		case *parse.TextNode:
+			fn.text = append(fn.text, node.Text...)
+		case *parse.SpaceNode:
+			fn.text = append(fn.text, node.Text...)
+		case *parse.CRNode:
+			fn.text = append(fn.text, node.Text...)
+		case *parse.NLNode:
+			fn.text = append(fn.text, node.Text...)
+			g.flush(true)
+		case *parse.CommentNode:
+			// Comments are elided.
+		case *parse.BlockNode:
+			o, ok := fn.blocks[node.Name]
+			if !ok {
+				g.nodes(node.List)
+				break
+			}
+			if !hasTags(o.node.List) {
+				g.nodes(o.node.List)
+				break
+			}
+			// Errors in the override are located in its template.
+			g.flush(false)
+			g.printf("c.Block(%q, func(c *rollie.Context) {\n", o.tmpl)
+			fn.files = append(fn.files, o.tmpl)
+			g.list(o.node.List)
+			fn.files = fn.files[:len(fn.files)-1]
+			g.printf("})\n")
+		default:
+			g.flush(false)
+			g.node(node)
+		}
+	}
+}
+
+// hasTags reports whether a list has nodes other than text and comments.
+func hasTags(list *parse.ListNode) bool {
+	for _, node := range list.Nodes {
+		switch node.(type) {
+		case *parse.TextNode, *parse.SpaceNode, *parse.CRNode, *parse.NLNode, *parse.CommentNode:
+		default:
+			return true
+		}
+	}
+	return false
+}
+
+// flush writes the pending text as a constant; nl is set if it ends a line.
+func (g *generator) flush(nl bool) {
+	fn := g.fn
+	if len(fn.text) == 0 {
+		return
+	}
+	method := "Text"
+	if nl {
+		method = "Line"
+	}
+	g.printf("c.%s(%s)\n", method, strconv.Quote(string(fn.text)))
+	fn.text = fn.text[:0]
+}
+
+// node generates the code for a tag.
+func (g *generator) node(node parse.Node) {
+	switch node := node.(type) {
+	case *parse.VariableNode:
+		g.tag = node.String()
+		g.variable(node.Ident, node.Line, node.Escaped())
+	case *parse.DotNode:
+		g.tag = node.String()
+		g.write(g.top(), node.Escaped(), node.Line)
+	case *parse.SectionNode:
+		g.tag = "{{#" + node.Name() + "}}"
+		g.section(node)
+	case *parse.InvertedNode:
+		g.tag = "{{^" + node.Name() + "}}"
+		g.inverted(node)
+	case *parse.PartialNode:
+		g.partial(node.Ident, node.Line, node.Standalone, node.Indent, nil)
+	case *parse.ParentNode:
+		g.partial(node.Ident, node.Line, node.Standalone, node.Indent, node.Blocks())
+	default:
+		g.errorf(0, "unknown node: %s", node)
+	}
+}
+
+// variable generates the code for a variable tag.
+func (g *generator) variable(ident []string, line int, escaped bool) {
+	found := func(v value) { g.write(v, escaped, line) }
+	g.resolve(ident, line, found, g.missing(ident, line, found))
+}
+
+// write generates the code to write v, the value of a variable or implicit
+// iterator tag. Like a missing value, a nil pointer is written as the
+// empty string.
+func (g *generator) write(v value, escaped bool, line int) {
+	if isLambda(v.typ) {
+		g.errorf(line, "%s: lambdas can't be generated", g.tag)
+	}
+	method := "Text"
+	if escaped {
+		method = "Escaped"
+	}
+	w, conds := indirect(v)
+	if _, ok := w.typ.Underlying().(*types.Signature); ok {
+		g.errorf(line, "%s: values of func type %s can't be printed", g.tag, g.typeName(w.typ))
+	}
+	str := g.str(w, line)
+	if len(conds) == 0 {
+		g.printf("c.%s(%s)\n", method, str)
+		return
+	}
+	g.printf("if %s {\nc.%s(%s)\n} else {\nc.%s(\"\")\n}\n", and(conds), method, str, method)
+}
+
+// section generates the code for a section.
+func (g *generator) section(sec *parse.SectionNode) {
+	found := func(v value) { g.sectionValue(sec, v) }
+	g.resolve(sec.Ident, sec.Line, found, g.missing(sec.Ident, sec.Line, found))
+}
+
+// sectionValue generates the code to render a section with v, its value:
+// once for each element of a non-empty list, or once with the value pushed
+// onto the context stack for any other truthy value.
+func (g *generator) sectionValue(sec *parse.SectionNode, v value) {
+	if isLambda(v.typ) {
+		g.errorf(sec.Line, "%s: lambdas can't be generated", g.tag)
+	}
+	fn := g.fn
+	w, conds := indirect(v)
+	switch cond := g.truth(w, sec.Line); cond {
+	case "false":
+		return
+	case "true":
+	default:
+		conds = append(conds, cond)
+	}
+	if len(conds) > 0 {
+		g.printf("if %s {\n", and(conds))
+	}
+	switch t := w.typ.Underlying().(type) {
+	case *types.Array, *types.Slice:
+		var elem types.Type
+		addr := w.addr
+		if a, ok := t.(*types.Array); ok {
+			elem = a.Elem()
+		} else {
+			elem = t.(*types.Slice).Elem()
+			addr = true
+		}
+		i, e := g.local("i"), g.local("e")
+		el := value{expr: e, typ: elem, addr: addr}
+		bind := fmt.Sprintf("%s := %s[%s]\n", e, w.val(), i)
+		if _, ok := elem.Underlying().(*types.Pointer); !ok && addr {
+			// Elements are addressable, so their pointer methods
+			// are found.
+			el.ptr = true
+			bind = fmt.Sprintf("%s := &%s[%s]\n", e, w.val(), i)
+		}
+		fn.frames = append(fn.frames, frame{v: el})
+		fn.loops = append(fn.loops, loop{index: i, len: "len(" + w.val() + ")"})
+		body := g.capture(func() { g.list(sec.List) })
+		fn.loops = fn.loops[:len(fn.loops)-1]
+		fn.frames = fn.frames[:len(fn.frames)-1]
+		switch {
+		case used(body, e):
+			g.printf("for %s := range %s {\n%s", i, w.val(), bind)
+		case used(body, i):
+			g.printf("for %s := range %s {\n", i, w.val())
+		default:
+			g.printf("for range %s {\n", w.val())
+		}
+		fn.buf.Write(body)
+		g.printf("}\n")
+	case *types.Basic:
+		if t.Info()&types.IsBoolean == 0 {
+			g.push(w, sec.List)
+			break
+		}
+		// A true boolean doesn't provide a new context.
+		g.list(sec.List)
+	default:
+		g.push(w, sec.List)
+	}
+	if len(conds) > 0 {
+		g.printf("}\n")
+	}
+}
+
+// push generates the code for a list with v pushed onto the context stack.
+func (g *generator) push(v value, list *parse.ListNode) {
+	fn := g.fn
+	fn.frames = append(fn.frames, frame{v: v})
+	g.list(list)
+	fn.frames = fn.frames[:len(fn.frames)-1]
+}
+
+// inverted generates the code for an inverted section, which is rendered
+// only if its value is missing, false or an empty list.
+func (g *generator) inverted(inv *parse.InvertedNode) {
+	t := g.local("t")
+	g.printf("%s := false\n", t)
+	found := func(v value) {
+		w, conds := indirect(v)
+		switch cond := g.truth(w, inv.Line); cond {
+		case "false":
+			return
+		case "true":
+		default:
+			conds = append(conds, cond)
+		}
+		if len(conds) == 0 {
+			conds = []string{"true"}
+		}
+		g.printf("%s = %s\n", t, and(conds))
+	}
+	g.resolve(inv.Ident, inv.Line, found, func(int, value, string) {})
+	g.printf("if !%s {\n", t)
+	g.list(inv.List)
+	g.printf("}\n")
+}
+
+// resolve generates the code to resolve ident, as lookup does, or, if it
+// is an iteration marker, to get its value.
+func (g *generator) resolve(ident []string, line int, found func(value), missing func(int, value, string)) {
+	if len(ident) == 1 && ident[0] == "." {
+		found(g.top())
+		return
+	}
+	v, cond, ok := g.marker(ident)
+	switch {
+	case !ok:
+		g.lookup(ident, line, found, missing)
+	case v.expr == "":
+		missing(0, g.top(), g.depth(0))
+	case cond == "":
+		found(v)
+	default:
+		g.printf("if %s {\n", cond)
+		found(v)
+		g.printf("} else {\n")
+		missing(0, g.top(), g.depth(0))
+		g.printf("}\n")
+	}
+}
+
+// marker returns the value of ident if it is an iteration marker, as for
+// rollie's marker, and the condition, if any, under which it isn't
+// missing; its expression is empty if it is always missing. -index is the
+// 1-based index of the element of the innermost list section; -first,
+// -last and -odd report whether the element is the first, the last, or has
+// an odd -index.
+func (g *generator) marker(ident []string) (v value, cond string, ok bool) {
+	if len(ident) != 1 {
+		return value{}, "", false
+	}
+	name := ident[0]
+	switch name {
+	case "-index", "-first", "-last", "-odd":
+	default:
+		return value{}, "", false
+	}
+	loops := g.fn.loops
+	if len(loops) == 0 {
+		if name == "-index" {
+			return value{}, "", true
+		}
+		return value{expr: "false", typ: types.Typ[types.Bool]}, "", true
+	}
+	l := loops[len(loops)-1]
+	var expr string
+	switch name {
+	case "-index":
+		return value{expr: l.index + " + 1", typ: types.Typ[types.Int]}, l.in, true
+	case "-first":
+		expr = l.index + " == 0"
+	case "-last":
+		expr = l.index + " == " + l.len + "-1"
+	default:
+		expr = l.index + "%2 == 0"
+	}
+	if l.in != "" {
+		expr = l.in + " && " + expr
+	}
+	return value{expr: "(" + expr + ")", typ: types.Typ[types.Bool]}, "", true
+}
+
+// missing returns the function that generates the code to handle ident,
+// on the given line, when it isn't found, according to the missingkey
+// option; see lookup. If the field was looked for in a map, found
+// generates the code for the zero value of its elements.
+func (g *generator) missing(ident []string, line int, found func(value)) func(int, value, string) {
+	return func(field int, in value, depth string) {
+		call := fmt.Sprintf("c.Missing(%d, %q, %d, %s)", line, strings.Join(ident, "."), field, depth)
+		m, conds := indirect(in)
+		t, ok := m.typ.Underlying().(*types.Map)
+		if !ok {
+			g.printf("%s\n", call)
+			return
+		}
+		g.printf("if %s {\n", and(append([]string{call}, conds...)))
+		zero := g.local("v")
+		body := g.capture(func() { found(value{expr: zero, typ: t.Elem()}) })
+		if used(body, zero) {
+			g.printf("var %s %s\n", zero, g.typeName(t.Elem()))
+		}
+		g.fn.buf.Write(body)
+		g.printf("}\n")
+	}
+}
+
+// lookup generates the code to resolve ident against the context stack,
+// as rollie's lookup does: the first field is searched for from the top of
+// the stack down and the rest within the value that was found. found
+// generates the code for the value; missing, that for when a field isn't
+// found, given the index of the field, the value it was looked for in and
+// the expression of the number of contexts searched for the first field.
+func (g *generator) lookup(ident []string, line int, found func(value), missing func(int, value, string)) {
+	l := &lookup{g: g, ident: ident, line: line, found: found, missing: missing, done: g.local("done")}
+	code := g.capture(l.run)
+	if !l.jumped {
+		g.fn.buf.Write(code)
+		return
+	}
+	// The label follows the block, so the code doesn't jump over the
+	// declarations of its variables.
+	g.printf("{\n%s}\n%s:\n", code, l.done)
+}
+
+// lookup is the generation of the code to resolve a name. The code for
+// each context the name may be in ends by jumping to done.
+type lookup struct {
+	g       *generator
+	ident   []string
+	line    int
+	found   func(value)
+	missing func(int, value, string)
+	done    string
+	jumped  bool
+}
+
+func (l *lookup) run() {
+	g := l.g
+	frames := g.fn.frames
+	for i := len(frames) - 1; i >= 0; i-- {
+		f := frames[i]
+		if f.levels == nil {
+			if l.try(f.v, g.depth(i), false) {
+				return
+			}
+		} else if l.levels(f.levels, i) {
+			return
+		}
+	}
+	l.missing(0, g.top(), g.depth(0))
+}
+
+// jump generates the jump to the end of the lookup.
+func (l *lookup) jump() {
+	l.g.printf("goto %s\n", l.done)
+	l.jumped = true
+}
+
+// try generates the code to look for the name in v, a context, which is
+// depth contexts from the top of the stack. It reports whether the first
+// field is always found in v. The code jumps to the end of the lookup once
+// the name is handled if it may not be found, or if loop is set.
+func (l *lookup) try(v value, depth string, loop bool) bool {
+	a := l.g.member(v, l.ident[0], l.line)
+	if a == nil {
+		return false
+	}
+	always := a.always()
+	l.g.access(a, func(w value) {
+		l.rest(w, 1, depth)
+		if !always || loop {
+			l.jump()
+		}
+	})
+	return always
+}
+
+// rest generates the code to resolve the jth and later fields of the name
+// in v.
+func (l *lookup) rest(v value, j int, depth string) {
+	if j == len(l.ident) {
+		l.found(v)
+		return
+	}
+	a := l.g.member(v, l.ident[j], l.line)
+	if a == nil {
+		l.missing(j, v, depth)
+		return
+	}
+	always := a.always()
+	l.g.access(a, func(w value) {
+		l.rest(w, j+1, depth)
+		if !always {
+			l.jump()
+		}
+	})
+	if !always {
+		l.missing(j, v, depth)
+	}
+}
+
+// levels generates the code to look for the name in the levels of a
+// recursive partial, the ith frame, from the last down. It reports whether
+// the name is always found, as there is always a level.
+func (l *lookup) levels(lv *levels, i int) bool {
+	g := l.g
+	n := len(lv.fields)
+	top := lv.fields[n-1]
+	top.expr = fmt.Sprintf("%s[len(%s)-1].%s", lv.expr, lv.expr, top.expr)
+	if a := g.member(top, l.ident[0], l.line); a != nil && a.always() {
+		// It is always found in the top of the last level.
+		depth := "1"
+		if i+1 < len(g.fn.frames) {
+			depth = g.depth(i+1) + " + 1"
+		}
+		return l.try(top, depth, false)
+	}
+	idx, e := g.local("l"), g.local("lv")
+	always := false
+	body := g.capture(func() {
+		for k := len(lv.fields) - 1; k >= 0 && !always; k-- {
+			v := lv.fields[k]
+			v.expr = e + "." + v.expr
+			always = l.try(v, g.levelDepth(i, idx, k), true)
+		}
+	})
+	if len(body) == 0 {
+		return false
+	}
+	g.printf("for %s := len(%s) - 1; %s >= 0; %s-- {\n", idx, lv.expr, idx, idx)
+	g.printf("%s := &%s[%s]\n", e, lv.expr, idx)
+	g.fn.buf.Write(body)
+	g.printf("}\n")
+	return always
+}
+
+// access generates the code to get a member, whose value body generates
+// the code for.
+func (g *generator) access(a *access, body func(value)) {
+	code := g.capture(func() { body(a.v) })
+	// A method's result, or a map's element, is bound to a variable.
+	val := a.v.expr
+	if (a.call != "" || a.index != "") && !used(code, val) {
+		val = "_"
+	}
+	closing := 0
+	if len(a.conds) > 0 {
+		g.printf("if %s {\n", and(a.conds))
+		closing++
+	}
+	switch {
+	case a.err:
+		err := g.local("err")
+		g.printf("%s, %s := %s\n", val, err, a.call)
+		g.printf("if %s != nil {\nc.Error(%d, %q, %s)\n}\n", err, a.line, a.name, err)
+	case a.call != "" && val == "_":
+		g.printf("%s\n", a.call)
+	case a.call != "":
+		g.printf("%s := %s\n", val, a.call)
+	}
+	if a.index != "" {
+		g.printf("if %s, ok := %s; ok {\n", val, a.index)
+		closing++
+	}
+	g.fn.buf.Write(code)
+	g.printf("%s", strings.Repeat("}\n", closing))
+}
+
+// capture returns the code generated by gen.
+func (g *generator) capture(gen func()) []byte {
+	fn := g.fn
+	buf := fn.buf
+	fn.buf = new(bytes.Buffer)
+	gen()
+	code := fn.buf.Bytes()
+	fn.buf = buf
+	return code
+}
+
+// used reports whether code refers to the named variable.
+func used(code []byte, name string) bool {
+	return regexp.MustCompile(`\b` + regexp.QuoteMeta(name) + `\b`).Match(code)
+}
+
+// and returns the conjunction of the conditions.
+func and(conds []string) string {
+	return strings.Join(conds, " && ")
+}
+
+// top returns the top of the context stack.
+func (g *generator) top() value {
+	f := g.fn.frames[len(g.fn.frames)-1]
+	if f.levels == nil {
+		return f.v
+	}
+	v := f.levels.fields[len(f.levels.fields)-1]
+	v.expr = fmt.Sprintf("%s[len(%s)-1].%s", f.levels.expr, f.levels.expr, v.expr)
+	return v
+}
+
+// depth returns the expression of the number of contexts from the top of
+// the stack down to the ith frame, inclusive.
+func (g *generator) depth(i int) string {
+	n := 0
+	var terms []string
+	for _, f := range g.fn.frames[i:] {
+		if f.levels == nil {
+			n++
+			continue
+		}
+		terms = append(terms, fmt.Sprintf("len(%s)*%d", f.levels.expr, len(f.levels.fields)))
+	}
+	if n > 0 || len(terms) == 0 {
+		terms = append(terms, strconv.Itoa(n))
+	}
+	return strings.Join(terms, " + ")
+}
+
+// levelDepth returns the expression of the number of contexts from the top
+// of the stack down to the kth context of the level at idx of the ith
+// frame, inclusive.
+func (g *generator) levelDepth(i int, idx string, k int) string {
+	lv := g.fn.frames[i].levels
+	d := fmt.Sprintf("(len(%s)-1-%s)*%d + %d", lv.expr, idx, len(lv.fields), len(lv.fields)-k)
+	if i+1 < len(g.fn.frames) {
+		d = g.depth(i+1) + " + " + d
+	}
+	return d
+}
+
+// partial generates the code for a partial or, if it has blocks, a parent.
+// The template is inlined, unless it is already being generated, in which
+// case it is rendered by a recursive function; see recurse. Blocks that are
+// already overridden, by a template that extends this one, keep their
+// overrides.
+func (g *generator) partial(name string, line int, standalone bool, indent string, blocks []*parse.BlockNode) {
+	t, ok := g.tmpl[name]
+	if !ok {
+		g.errorf(line, "partial %q not found", name)
+	}
+	fn := g.fn
+	old := fn.blocks
+	if len(blocks) > 0 {
+		in := fn.files[len(fn.files)-1]
+		fn.blocks = make(map[string]block, len(old)+len(blocks))
+		for name, b := range old {
+			fn.blocks[name] = b
+		}
+		for _, b := range blocks {
+			if _, ok := fn.blocks[b.Name]; !ok {
+				fn.blocks[b.Name] = block{b, in}
+			}
+		}
+	}
+	g.printf("c.Partial(%q, %t, %q, func(c *rollie.Context) {\n", name, standalone, indent)
+	if k := g.generating(name); k >= 0 {
+		// The recursive function knows nothing of the blocks.
+		if len(fn.blocks) > 0 {
+			g.errorf(line, "%q includes itself within a parent", name)
+		}
+		g.recurse(k, line)
+	} else {
+		fn.inline = append(fn.inline, include{name, len(fn.frames)})
+		fn.files = append(fn.files, name)
+		g.list(t.tree.Root)
+		fn.files = fn.files[:len(fn.files)-1]
+		fn.inline = fn.inline[:len(fn.inline)-1]
+	}
+	g.printf("})\n")
+	fn.blocks = old
+}
+
+// generating returns the index of the named template among those being
+// generated, or -1.
+func (g *generator) generating(name string) int {
+	for i, in := range g.fn.inline {
+		if in.name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// recurse generates the call of the render function of the kth template
+// being generated, which has included itself. The function is passed the
+// contexts the template was first included with, which don't change, and
+// the contexts pushed since by each include, its levels. Names that aren't
+// in the last level are looked for in those before it, then in the first
+// contexts, as they would be in the stack. Each include must push contexts
+// of the same types.
+func (g *generator) recurse(k, line int) {
+	fn := g.fn
+	in := fn.inline[k]
+	pushed := fn.frames[in.frames:]
+	if len(pushed) == 0 {
+		g.errorf(line, "%q includes itself with the same context, so it never ends", in.name)
+	}
+	if k == 0 && fn.rec != nil {
+		// The function's template has included itself again.
+		rec := fn.rec
+		if !sameValues(pushed, rec.level.fields) {
+			g.errorf(line, "%q includes itself with contexts of other types", in.name)
+		}
+		g.printf("%s(c, %sappend(levels, %s), %s)\n", rec.name, args(fn.frames[:rec.params]), g.level(rec, pushed), g.loopArgs())
+		return
+	}
+	if fn.depth >= maxRecursion {
+		g.errorf(line, "%q includes itself within too many partials that include themselves", in.name)
+	}
+	outer := fn.frames[:in.frames]
+	key := in.name + "|" + g.frameKey(outer) + "|" + g.frameKey(pushed)
+	rec, ok := g.funcs[key]
+	if !ok {
+		rec = g.recursive(in.name, outer, pushed)
+		g.funcs[key] = rec
+	}
+	lv := g.level(rec, pushed)
+	g.printf("%s(c, %s[]%s{%s}, %s)\n", rec.name, args(outer), rec.level.typ, strings.TrimPrefix(lv, rec.level.typ), g.loopArgs())
+}
+
+// recursive generates the render function of the named template, which
+// includes itself, for the contexts it was first included with and those
+// pushed before it included itself.
+func (g *generator) recursive(name string, outer, pushed []frame) *recursion {
+	base := lowerFirst(g.prefix + goName(name))
+	rec := &recursion{
+		name:   g.unique(base),
+		params: len(outer),
+		level:  &levels{expr: "levels", typ: g.unique(base + "Level")},
+	}
+	var frames []frame
+	var params []string
+	for i, f := range outer {
+		p := fmt.Sprintf("d%d", i)
+		if f.levels != nil {
+			lv := *f.levels
+			lv.expr = p
+			frames = append(frames, frame{levels: &lv})
+			params = append(params, p+" []"+lv.typ)
+			continue
+		}
+		v := f.v
+		v.expr = p
+		frames = append(frames, frame{v: v})
+		params = append(params, p+" "+g.valueType(v))
+	}
+	fmt.Fprintf(&g.decls, "\n// %s is a level of %s.\ntype %s struct {\n", rec.level.typ, rec.name, rec.level.typ)
+	for i, f := range pushed {
+		v := f.v
+		v.expr = fmt.Sprintf("f%d", i)
+		rec.level.fields = append(rec.level.fields, v)
+		fmt.Fprintf(&g.decls, "%s %s\n", v.expr, g.valueType(v))
+	}
+	g.decls.WriteString("}\n")
+	frames = append(frames, frame{levels: rec.level})
+	var body bytes.Buffer
+	fmt.Fprintf(&body, "\n// %s renders the %s template, which includes itself.\n", rec.name, name)
+	fmt.Fprintf(&body, "func %s(c *rollie.Context, ", rec.name)
+	for _, p := range params {
+		body.WriteString(p + ", ")
+	}
+	fmt.Fprintf(&body, "levels []%s, li, ln int) {\n", rec.level.typ)
+	old := g.fn
+	g.fn = &function{
+		buf:    &body,
+		inline: []include{{name, len(frames)}},
+		files:  []string{name},
+		frames: frames,
+		loops:  []loop{{index: "li", len: "ln", in: "ln > 0"}},
+		rec:    rec,
+		depth:  old.depth + 1,
+	}
+	g.list(g.tmpl[name].tree.Root)
+	g.fn = old
+	body.WriteString("}\n")
+	g.decls.Write(body.Bytes())
+	return rec
+}
+
+// frameKey returns a string that identifies the types of the frames, as
+// the parameters of a recursive function.
+func (g *generator) frameKey(frames []frame) string {
+	keys := make([]string, len(frames))
+	for i, f := range frames {
+		if f.levels != nil {
+			keys[i] = "[]" + f.levels.typ
+		} else {
+			keys[i] = g.valueType(f.v) + " " + strconv.FormatBool(f.v.addr)
+		}
+	}
+	return strings.Join(keys, ",")
+}
+
+// valueType returns the Go type of the expression of v.
+func (g *generator) valueType(v value) string {
+	if v.ptr {
+		return "*" + g.typeName(v.typ)
+	}
+	return g.typeName(v.typ)
+}
+
+// level returns the composite literal of a level of rec with the pushed
+// contexts.
+func (g *generator) level(rec *recursion, pushed []frame) string {
+	fields := make([]string, len(pushed))
+	for i, f := range pushed {
+		fields[i] = rec.level.fields[i].expr + ": " + f.v.expr
+	}
+	return rec.level.typ + "{" + strings.Join(fields, ", ") + "}"
+}
+
+// loopArgs returns the arguments of a recursive function for the innermost
+// list section.
+func (g *generator) loopArgs() string {
+	loops := g.fn.loops
+	if len(loops) == 0 {
+		return "0, 0"
+	}
+	l := loops[len(loops)-1]
+	return l.index + ", " + l.len
+}
+
+// args returns the arguments of a recursive function for the frames,
+// followed by a comma if there are any.
+func args(frames []frame) string {
+	var b strings.Builder
+	for _, f := range frames {
+		if f.levels != nil {
+			b.WriteString(f.levels.expr)
+		} else {
+			b.WriteString(f.v.expr)
+		}
+		b.WriteString(", ")
+	}
+	return b.String()
+}
+
+// sameValues reports whether the frames are values of the types of vs.
+func sameValues(frames []frame, vs []value) bool {
+	if len(frames) != len(vs) {
+		return false
+	}
+	for i, f := range frames {
+		v := vs[i]
+		if f.levels != nil || !types.Identical(f.v.typ, v.typ) || f.v.ptr != v.ptr || f.v.addr != v.addr {
+			return false
+		}
+	}
+	return true
+}
+
+// quoteList returns the strings as a list of Go strings.
+func quoteList(list []string) string {
+	q := make([]string, len(list))
+	for i, s := range list {
+		q[i] = strconv.Quote(s)
+	}
+	return strings.Join(q, ", ")
+}
+
+// goName returns the template name in camel case: the runs of letters and
+// digits, each with its first letter in upper case, e.g. "user-welcome" is
+// UserWelcome.
+func goName(name string) string {
+	var b strings.Builder
+	upper := true
+	for _, r := range name {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			upper = true
+			continue
+		}
+		if upper {
+			r = unicode.ToUpper(r)
+			upper = false
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// lowerFirst returns s with its first letter in lower case.
+func lowerFirst(s string) string {
+	r, n := utf8.DecodeRuneInString(s)
+	return string(unicode.ToLower(r)) + s[n:]
+}
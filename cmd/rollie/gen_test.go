@@ -0,0 +1,383 @@
+// Copyright 2014 Joel Scoble (github:mohae). All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/mohae/rollie/parse"
+)
+
+// templates parses the sources, given as name and source pairs.
+func templates(t *testing.T, src ...string) []*template {
+	var tmpls []*template
+	for i := 0; i < len(src); i += 2 {
+		tree, err := parse.Parse(src[i], src[i+1], "", "")
+		if err != nil {
+			t.Fatalf("%s: %s", src[i], err)
+		}
+		tmpls = append(tmpls, &template{name: src[i], filename: src[i] + ".mustache", tree: tree})
+	}
+	return tmpls
+}
+
+// viewsSrc is the source of the package of the generated code of the tests
+// that don't build it.
+const viewsSrc = `package views
+
+type Page struct {
+	Title string
+	Items []string
+	Raw   string ` + "`mustache:\"html\"`" + `
+	Kids  []*Page
+	Any   interface{}
+	Link  func() string
+	Sum   func(int) int
+}
+`
+
+// testConfig returns the config of a generation, in the package of
+// viewsSrc, for data of type *Page.
+func testConfig(t *testing.T, options ...string) *config {
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, "views.go", viewsSrc, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pkg, err := new(types.Config).Check("views", fset, []*ast.File{f}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := dataType(pkg, "*Page")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &config{cmd: "rollie gen test", pkg: pkg, prefix: "Render", data: data, options: options}
+}
+
+func TestGenerate(t *testing.T) {
+	tmpls := templates(t,
+		"user-page", "<h1>{{title}}</h1>\n{{#items}}\n  {{>item}}\n{{/items}}{{^items}}none{{/items}}\n{{{html}}}{{! no }}",
+		"item", "<li>{{.}}</li>\n",
+	)
+	src, err := generate(testConfig(t, "missingkey=error"), tmpls)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := string(src)
+	for _, want := range []string{
+		"// Code generated by \"rollie gen test\"; DO NOT EDIT.\n",
+		"package views\n",
+		"var RenderOptions = rollie.New(\"Render\").Option(\"missingkey=error\")\n",
+		"func RenderUserPage(w io.Writer, data *Page) error {\n\treturn rollie.Run(RenderOptions, \"user-page\", w, func(c *rollie.Context) {\n\t\tc.Text(\"<h1>\")\n",
+		// Names are resolved when the code is generated.
+		"c.Escaped((*data).Title)",
+		"c.Missing(1, \"title\", 0, 1)",
+		// The partial is inlined.
+		"c.Partial(\"item\", true, \"  \", func(c *rollie.Context) {\n\t\t\t\t\t\t\tc.Text(\"<li>\")\n\t\t\t\t\t\t\tc.Escaped((*e",
+		"c.Text((*data).Raw)",
+		"func RenderItem(w io.Writer, data *Page) error {",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("expected the output to contain\n%s\ngot\n%s", want, got)
+		}
+	}
+}
+
+func TestGenerateRecursive(t *testing.T) {
+	tmpls := templates(t, "tree", "{{Title}}{{#Kids}}{{>tree}}{{/Kids}}")
+	src, err := generate(testConfig(t), tmpls)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := string(src)
+	for _, want := range []string{
+		// A partial that includes itself calls its render function.
+		"renderTree(c, data, []renderTreeLevel{{f0: e",
+		"type renderTreeLevel struct {\n\tf0 *Page\n}\n",
+		"func renderTree(c *rollie.Context, d0 *Page, levels []renderTreeLevel, li, ln int) {\n",
+		"renderTree(c, d0, append(levels, renderTreeLevel{f0: e",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("expected the output to contain\n%s\ngot\n%s", want, got)
+		}
+	}
+}
+
+func TestGenerateParent(t *testing.T) {
+	tmpls := templates(t,
+		"page", "{{<layout}}{{$body}}hello{{/body}}{{/layout}}",
+		"layout", "<b>{{$body}}default{{/body}}</b>{{$foot}}foot{{/foot}}",
+	)
+	src, err := generate(testConfig(t), tmpls)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "return rollie.Run(RenderOptions, \"page\", w, func(c *rollie.Context) {\n\t\tc.Partial(\"layout\", false, \"\", func(c *rollie.Context) {\n\t\t\tc.Text(\"<b>hello</b>foot\")\n\t\t})\n\t})\n"
+	if !strings.Contains(string(src), want) {
+		t.Errorf("expected the output to contain\n%s\ngot\n%s", want, src)
+	}
+}
+
+var generateErrorTests = []struct {
+	name    string
+	src     []string
+	options []string
+	err     string
+}{
+	{"missing partial", []string{"page", "\n{{>nope}}"}, nil, "page.mustache:2: partial \"nope\" not found"},
+	{"duplicate", []string{"page", "", "page", ""}, nil, "duplicate template name \"page\""},
+	{"same function", []string{"a-b", "", "a_b", ""}, nil, "are both rendered by RenderAB"},
+	{"options", []string{"options", ""}, nil, "template \"options\" is rendered by RenderOptions"},
+	{"recursive parent", []string{"page", "{{#Kids}}{{<page}}{{$a}}{{/a}}{{/page}}{{/Kids}}"}, nil, "\"page\" includes itself within a parent"},
+	{"same context", []string{"page", "{{>page}}"}, nil, "\"page\" includes itself with the same context"},
+	{"interface", []string{"page", "\n{{Any.x}}"}, nil, "page.mustache:2: {{Any.x}}: values of interface type interface{} can't be generated"},
+	{"lambda", []string{"page", "{{Link}}"}, nil, "{{Link}}: lambdas can't be generated"},
+	{"func", []string{"page", "{{Sum}}"}, nil, "{{Sum}}: values of func type func(int) int can't be printed"},
+	{"bad option", []string{"page", ""}, []string{"missingpartial=nope"}, "missingpartial=nope"},
+	{"contextual", []string{"page", ""}, []string{"escape=contextual"}, "can't be escaped by the ContextualEscaper"},
+}
+
+func TestGenerateErrors(t *testing.T) {
+	for _, test := range generateErrorTests {
+		_, err := generate(testConfig(t, test.options...), templates(t, test.src...))
+		if err == nil {
+			t.Errorf("%s: expected error; got none", test.name)
+			continue
+		}
+		if !strings.Contains(err.Error(), test.err) {
+			t.Errorf("%s: expected error containing %q; got %q", test.name, test.err, err)
+		}
+	}
+	c := testConfig(t)
+	c.prefix = ""
+	if _, err := generate(c, templates(t, "1page", "")); err == nil {
+		t.Error("expected an error for a name that isn't a Go identifier")
+	}
+}
+
+func TestGoName(t *testing.T) {
+	for name, want := range map[string]string{
+		"page":         "Page",
+		"user-welcome": "UserWelcome",
+		"a.b_c d":      "ABCD",
+		"v2":           "V2",
+	} {
+		if got := goName(name); got != want {
+			t.Errorf("goName(%q): expected %q, got %q", name, want, got)
+		}
+	}
+}
+
+// The files of the module that TestGenerateRun builds, by their names.
+var runFiles = map[string]string{
+	"data.go": `package views
+
+import "errors"
+
+type Page struct {
+	Title  string
+	Items  []Item
+	Tags   map[string]string
+	Author *Person
+	Count  int
+	Admin  bool
+	Nums   [3]int
+	Embedded
+	*Extra
+	Raw string ` + "`mustache:\"html\"`" + `
+}
+
+type Embedded struct{ Note string }
+
+type Extra struct{ Tag string }
+
+func (e *Extra) Badge() string { return "badge:" + e.Tag }
+
+type Item struct {
+	Name  string
+	Price float64
+	Kids  []Item
+}
+
+func (i *Item) Label() string { return "label:" + i.Name }
+
+type Person struct {
+	Name string
+	Age  int
+}
+
+func (p Person) Greeting() string { return "Hi " + p.Name }
+
+func (p *Person) Fail() (string, error) { return "", errors.New("failed") }
+
+type Node struct {
+	Name string
+	Kids []*Node
+}
+`,
+	"tmpl/page.mustache": `<h1>{{Title}}</h1>
+{{#Items}}
+  {{>item}}
+{{/Items}}
+{{^Items}}none{{/Items}}
+{{#Author}}{{Greeting}} {{Name}} {{Age}}{{/Author}}{{^Author}}anon{{/Author}}
+{{Tags.a}} {{Tags.missing}} {{Count}} {{Admin}} {{{html}}} {{Note}} {{Badge}} {{Author.Name}}
+{{#Nums}}{{-index}}:{{.}}{{^-last}},{{/-last}}{{/Nums}}{{-first}}
+{{<layout}}{{$body}}[{{Title}}]{{/body}}{{/layout}}
+{{nope}}
+`,
+	"tmpl/item.mustache": `<li>{{Name}} {{Price}} {{Label}} {{Title}}{{#-first}} first{{/-first}}</li>
+{{#Kids}}
+  {{>item}}
+{{/Kids}}
+`,
+	"tmpl/layout.mustache": "<b>{{$body}}default{{/body}}</b>{{$foot}}foot{{/foot}}\n",
+	"tmpl/fail.mustache":   "a\n{{#Author}}{{Fail}}{{/Author}}\n",
+	"tree/tree.mustache":   "<{{Name}}{{#Kids}} {{-index}}{{>tree}}{{/Kids}}{{missing}}>",
+	"views_test.go": `package views
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/mohae/rollie"
+)
+
+var pages = []*Page{
+	nil,
+	{},
+	{
+		Title: "<T>",
+		Items: []Item{
+			{Name: "a", Price: 1.5, Kids: []Item{{Name: "a1", Kids: []Item{{Name: "a11"}}}, {Name: "a2"}}},
+			{Name: "b"},
+		},
+		Tags:     map[string]string{"a": "&"},
+		Author:   &Person{"Ann", 30},
+		Count:    3,
+		Admin:    true,
+		Nums:     [3]int{4, 5, 6},
+		Embedded: Embedded{"note"},
+		Extra:    &Extra{"x"},
+		Raw:      "<raw>",
+	},
+}
+
+var tree = &Node{"root", []*Node{{"a", []*Node{{"a1", nil}}}, {"b", nil}}}
+
+var options = []struct {
+	options []string
+	escaper rollie.Escaper
+}{
+	{},
+	{options: []string{"missingkey=error"}},
+	{options: []string{"missingkey=zero"}},
+	{options: []string{"escape=xml"}},
+	{escaper: rollie.EscaperFunc(func(s string) string { return "[" + s + "]" })},
+}
+
+// render returns the output, or the error, of a render.
+func render(fn func(*bytes.Buffer) error) string {
+	var b bytes.Buffer
+	if err := fn(&b); err != nil {
+		return "error: " + err.Error()
+	}
+	return b.String()
+}
+
+// TestGenerated checks that the generated render functions render as the
+// templates do.
+func TestGenerated(t *testing.T) {
+	for _, o := range options {
+		RenderOptions = rollie.New("Render").Option(o.options...).Escaper(o.escaper)
+		NodeOptions = rollie.New("Node").Option(o.options...).Escaper(o.escaper)
+		set := rollie.Must(rollie.New("set").Option(o.options...).Escaper(o.escaper).ParseGlob("tmpl/*.mustache"))
+		for name, fn := range map[string]func(*bytes.Buffer, *Page) error{
+			"page":   func(b *bytes.Buffer, p *Page) error { return RenderPage(b, p) },
+			"item":   func(b *bytes.Buffer, p *Page) error { return RenderItem(b, p) },
+			"layout": func(b *bytes.Buffer, p *Page) error { return RenderLayout(b, p) },
+			"fail":   func(b *bytes.Buffer, p *Page) error { return RenderFail(b, p) },
+		} {
+			tmpl := set.Lookup(name)
+			for i, p := range pages {
+				want := render(func(b *bytes.Buffer) error { return tmpl.Render(b, p) })
+				got := render(func(b *bytes.Buffer) error { return fn(b, p) })
+				if got != want {
+					t.Errorf("%v: %s: page %d: expected\n%s\ngot\n%s", o.options, name, i, want, got)
+				}
+			}
+		}
+		tmpl := rollie.Must(rollie.New("tree").Option(o.options...).Escaper(o.escaper).ParseGlob("tree/*.mustache"))
+		want := render(func(b *bytes.Buffer) error { return tmpl.Render(b, tree) })
+		got := render(func(b *bytes.Buffer) error { return NodeTree(b, tree) })
+		if got != want {
+			t.Errorf("%v: tree: expected\n%s\ngot\n%s", o.options, want, got)
+		}
+	}
+	RenderOptions = rollie.New("Render").Escaper(rollie.ContextualEscaper)
+	if err := RenderPage(new(bytes.Buffer), pages[2]); err == nil {
+		t.Error("expected an error for the ContextualEscaper")
+	}
+}
+`,
+}
+
+// TestGenerateRun generates the render functions of templates in a module
+// and checks, with the module's tests, that they render as the templates
+// do.
+func TestGenerateRun(t *testing.T) {
+	if testing.Short() {
+		t.Skip("builds a module")
+	}
+	if _, err := exec.LookPath("go"); err != nil {
+		t.Skip("no go command")
+	}
+	root, err := filepath.Abs("../..")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	files := map[string]string{
+		"go.mod": "module example.com/views\n\ngo 1.22\n\nrequire github.com/mohae/rollie v0.0.0\n\nreplace github.com/mohae/rollie => " + root + "\n",
+	}
+	for name, src := range runFiles {
+		files[name] = src
+	}
+	for name, src := range files {
+		filename := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(filename), 0777); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filename, []byte(src), 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// The module mustn't be in a workspace or need the network.
+	t.Setenv("GOWORK", "off")
+	t.Setenv("GOFLAGS", "-mod=mod")
+	t.Setenv("GOPROXY", "off")
+	for _, args := range [][]string{
+		{"-o", filepath.Join(dir, "page_gen.go"), "-type", "*Page", filepath.Join(dir, "tmpl", "*.mustache")},
+		{"-o", filepath.Join(dir, "tree_gen.go"), "-type", "*Node", "-prefix", "Node", filepath.Join(dir, "tree", "*.mustache")},
+	} {
+		if err := runGen(args); err != nil {
+			t.Fatal(err)
+		}
+	}
+	cmd := exec.Command("go", "test")
+	cmd.Dir = dir
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("go test: %v\n%s", err, out)
+	}
+}
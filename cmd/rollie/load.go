@@ -0,0 +1,117 @@
+// Copyright 2014 Joel Scoble (github:mohae). All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/build"
+	"go/importer"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// loadPackage type checks the Go package in dir, less the file skip, which
+// is the file being generated and may be out of date. The package may refer
+// to the render functions that are being generated, so type errors are
+// ignored; the generated code is checked when it is built.
+func loadPackage(dir, skip string) (*types.Package, error) {
+	bp, err := build.ImportDir(dir, 0)
+	if err != nil {
+		return nil, fmt.Errorf("gen: %w", err)
+	}
+	if skip, err = filepath.Abs(skip); err != nil {
+		return nil, err
+	}
+	fset := token.NewFileSet()
+	var files []*ast.File
+	imports := make(map[string]bool)
+	for _, name := range bp.GoFiles {
+		filename, err := filepath.Abs(filepath.Join(dir, name))
+		if err != nil {
+			return nil, err
+		}
+		if filename == skip {
+			continue
+		}
+		f, err := parser.ParseFile(fset, filename, nil, 0)
+		if err != nil {
+			return nil, fmt.Errorf("gen: %w", err)
+		}
+		files = append(files, f)
+		for _, spec := range f.Imports {
+			path, _ := strconv.Unquote(spec.Path.Value)
+			imports[path] = true
+		}
+	}
+	exports, err := exportData(dir, imports)
+	if err != nil {
+		return nil, err
+	}
+	conf := types.Config{
+		Importer: importer.ForCompiler(fset, "gc", func(path string) (io.ReadCloser, error) {
+			if file := exports[path]; file != "" {
+				return os.Open(file)
+			}
+			return nil, fmt.Errorf("no export data for %q", path)
+		}),
+		Error: func(error) {},
+	}
+	pkg, _ := conf.Check(bp.Name, fset, files, nil)
+	return pkg, nil
+}
+
+// exportData returns the files of the export data of the imported packages,
+// and of their dependencies, by their import paths, as built by the go
+// command in dir.
+func exportData(dir string, imports map[string]bool) (map[string]string, error) {
+	args := []string{"list", "-e", "-deps", "-export", "-f", "{{.ImportPath}} {{.Export}}"}
+	for path := range imports {
+		if path != "C" && path != "unsafe" {
+			args = append(args, path)
+		}
+	}
+	exports := make(map[string]string)
+	if len(args) == 6 {
+		return exports, nil
+	}
+	cmd := exec.Command("go", args...)
+	cmd.Dir = dir
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("gen: go list: %v: %s", err, bytes.TrimSpace(stderr.Bytes()))
+	}
+	sc := bufio.NewScanner(bytes.NewReader(out))
+	for sc.Scan() {
+		if path, file, ok := strings.Cut(sc.Text(), " "); ok && file != "" {
+			exports[path] = file
+		}
+	}
+	return exports, sc.Err()
+}
+
+// dataType returns the type of the data of the render functions, which is
+// given by a Go type expression in pkg, e.g. *Page.
+func dataType(pkg *types.Package, expr string) (types.Type, error) {
+	tv, err := types.Eval(token.NewFileSet(), pkg, token.NoPos, expr)
+	if err != nil {
+		return nil, fmt.Errorf("gen: -type %s: %w", expr, err)
+	}
+	if !tv.IsType() {
+		return nil, fmt.Errorf("gen: -type %s: not a type", expr)
+	}
+	return tv.Type, nil
+}
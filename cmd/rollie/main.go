@@ -0,0 +1,78 @@
+// Copyright 2014 Joel Scoble (github:mohae). All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Rollie is a tool for Mustache templates.
+//
+// Usage:
+//
+//	rollie gen [flags] files...
+//
+// Gen generates a Go file with a render function for each of the template
+// files, for data of a Go type of the package the file is generated in.
+// The templates are parsed, their partials found, and the names of their
+// tags resolved in the data's type, when the program is built rather than
+// when it runs, so the functions neither parse templates nor use
+// reflection. Each file is a template whose name is its base name without
+// the extension, the name used to refer to it as a partial; its render
+// function is named by the prefix followed by the name, in camel case. E.g.
+// "user-welcome.mustache", generated with -type *Page, is rendered by
+//
+//	func RenderUserWelcome(w io.Writer, data *Page) error
+//
+// Partials and parents are inlined, except those that include themselves,
+// which are rendered by functions that call themselves. Names are
+// resolved as rollie resolves them, to methods, map keys and struct
+// fields; whether a pointer is nil or a map has a key is checked when the
+// function runs. A missing partial, a value of an interface type, whose
+// names can't be resolved, and a lambda are errors. The files may be glob
+// patterns, for use with go generate:
+//
+//	//go:generate rollie gen -o templates.go -type *Page templates/*.mustache
+//
+// The functions render with the options and escaper of a *rollie.Template,
+// the variable named by the prefix followed by Options, e.g. RenderOptions,
+// which may be changed before they are called. The ContextualEscaper can't
+// escape generated code.
+//
+// The flags are:
+//
+//	-o file
+//		The file to write; the default is standard output. The data's
+//		type is of the package in the file's directory.
+//	-type type
+//		The Go type of the data, e.g. *Page or map[string]string; it
+//		is required.
+//	-option option
+//		An option of the templates, see rollie.Template.Option; it may
+//		be repeated.
+//	-prefix prefix
+//		The prefix of the render functions' names; the default is Render.
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+)
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "usage: rollie gen [flags] files...\n")
+	os.Exit(2)
+}
+
+func main() {
+	log.SetFlags(0)
+	log.SetPrefix("rollie: ")
+	if len(os.Args) < 2 {
+		usage()
+	}
+	switch os.Args[1] {
+	case "gen":
+		if err := runGen(os.Args[2:]); err != nil {
+			log.Fatal(err)
+		}
+	default:
+		usage()
+	}
+}
@@ -0,0 +1,395 @@
+// Copyright 2014 Joel Scoble (github:mohae). All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"go/token"
+	"go/types"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// Names are resolved in the types of the data when the code is generated,
+// as rollie resolves them in values when it renders, see rollie's
+// resolve.go: a method that takes no arguments and returns a value, or a
+// value and an error, else a map's key or a struct's field, named by its
+// mustache or json tag or its Go name. What can only be known when the code
+// runs, e.g. whether a pointer is nil or a map has a key, is checked by the
+// generated code. Values of interface types can't be looked into, so they
+// are an error.
+
+// value is a value of the data as the generated code refers to it.
+type value struct {
+	expr string     // the value or, if ptr is set, a pointer to it
+	typ  types.Type // the type of the value
+	ptr  bool
+	// addr is set if the value is addressable, so that the methods of
+	// pointers to it are found, as they are by reflection.
+	addr bool
+}
+
+// val returns the expression of the value itself.
+func (v value) val() string {
+	if v.ptr {
+		return "(*" + v.expr + ")"
+	}
+	return v.expr
+}
+
+// indirect returns v dereferenced until it isn't a pointer, and the
+// conditions, that the pointers aren't nil, under which it is valid.
+func indirect(v value) (value, []string) {
+	var conds []string
+	for {
+		p, ok := v.typ.Underlying().(*types.Pointer)
+		if !ok {
+			return v, conds
+		}
+		conds = append(conds, v.val()+" != nil")
+		v = value{expr: v.val(), typ: p.Elem(), ptr: true, addr: true}
+	}
+}
+
+// access is how to get a member of a value: the conditions under which it
+// is there, and, within them, the call of a method or the index of a map
+// that gets its value.
+type access struct {
+	conds []string
+	call  string // e.g. d0.Name()
+	index string // e.g. d0["name"], which may not have the key
+	line  int
+	name  string // the name of the member in the template, for its error
+	err   bool   // whether the method returns an error
+	v     value
+}
+
+// always reports whether the member is always there.
+func (a *access) always() bool {
+	return len(a.conds) == 0 && a.index == ""
+}
+
+var errorType = types.Universe.Lookup("error").Type()
+
+// member returns how to get the member of v that name resolves to, or nil
+// if it has none.
+func (g *generator) member(v value, name string, line int) *access {
+	g.check(v, line)
+	if _, ok := v.typ.Underlying().(*types.Pointer); ok {
+		// A nil pointer has no members.
+		if m := method(v.typ, name); m != nil {
+			return g.call(v, m, []string{v.val() + " != nil"}, name, line)
+		}
+	} else {
+		// Pointer methods are only in the method set of the pointer,
+		// which reflection uses if the value is addressable.
+		mtyp := v.typ
+		if v.addr {
+			mtyp = types.NewPointer(v.typ)
+		}
+		if m := method(mtyp, name); m != nil {
+			return g.call(v, m, nil, name, line)
+		}
+	}
+	w, conds := indirect(v)
+	g.check(w, line)
+	switch t := w.typ.Underlying().(type) {
+	case *types.Map:
+		if k, ok := t.Key().Underlying().(*types.Basic); !ok || k.Kind() != types.String {
+			return nil
+		}
+		return &access{
+			conds: conds,
+			index: fmt.Sprintf("%s[%s]", w.val(), strconv.Quote(name)),
+			v:     value{expr: g.local("v"), typ: t.Elem()},
+		}
+	case *types.Struct:
+		path := fieldOf(w.typ, name)
+		if path == nil {
+			return nil
+		}
+		expr, addr := w.val(), w.addr
+		for i, f := range path {
+			if i > 0 {
+				if _, ok := path[i-1].Type().Underlying().(*types.Pointer); ok {
+					// A field within a nil embedded pointer isn't there.
+					conds = append(conds, expr+" != nil")
+					addr = true
+				}
+			}
+			expr += "." + f.Name()
+		}
+		return &access{conds: conds, v: value{expr: expr, typ: path[len(path)-1].Type(), addr: addr}}
+	}
+	return nil
+}
+
+// call returns how to call m, the method of v that name resolves to. The
+// method isn't there if it is promoted from a nil embedded pointer.
+func (g *generator) call(v value, m *types.Selection, conds []string, name string, line int) *access {
+	recv := v.val()
+	if _, ok := v.typ.Underlying().(*types.Pointer); v.ptr && !ok {
+		// The pointer has all of the value's methods.
+		recv = v.expr
+	}
+	w, _ := indirect(v)
+	expr, typ := w.val(), w.typ
+	for _, x := range m.Index()[:len(m.Index())-1] {
+		f := typ.Underlying().(*types.Struct).Field(x)
+		expr += "." + f.Name()
+		typ = f.Type()
+		if p, ok := typ.Underlying().(*types.Pointer); ok {
+			typ = p.Elem()
+		} else if !types.IsInterface(typ) {
+			continue
+		}
+		if !f.Exported() && f.Pkg() != g.pkg {
+			g.errorf(line, "%s: method %s is promoted from unexported embedded field %s", g.tag, m.Obj().Name(), f.Name())
+		}
+		conds = append(conds, expr+" != nil")
+	}
+	res := m.Obj().Type().(*types.Signature).Results()
+	return &access{
+		conds: conds,
+		call:  fmt.Sprintf("%s.%s()", recv, m.Obj().Name()),
+		line:  line,
+		name:  name,
+		err:   res.Len() == 2,
+		v:     value{expr: g.local("v"), typ: res.At(0).Type()},
+	}
+}
+
+// method returns the selection of the method of typ that name resolves to,
+// or nil. As with reflection, only exported methods are seen, in order of
+// their names, and the first whose name matches regardless of case is used
+// if it takes no arguments and returns a value, or a value and an error.
+func method(typ types.Type, name string) *types.Selection {
+	ms := types.NewMethodSet(typ)
+	for i := 0; i < ms.Len(); i++ {
+		sel := ms.At(i)
+		m := sel.Obj().(*types.Func)
+		if !m.Exported() || !strings.EqualFold(m.Name(), name) {
+			continue
+		}
+		sig := m.Type().(*types.Signature)
+		res := sig.Results()
+		if sig.Params().Len() == 0 && (res.Len() == 1 || res.Len() == 2 && types.Identical(res.At(1).Type(), errorType)) {
+			return sel
+		}
+		return nil
+	}
+	return nil
+}
+
+// exportedMethods returns the number of exported methods of typ.
+func exportedMethods(typ types.Type) int {
+	n := 0
+	ms := types.NewMethodSet(typ)
+	for i := 0; i < ms.Len(); i++ {
+		if ms.At(i).Obj().Exported() {
+			n++
+		}
+	}
+	return n
+}
+
+// check raises an error if v's type can't be generated, as it is an
+// interface or has errors.
+func (g *generator) check(v value, line int) {
+	switch t := v.typ.Underlying().(type) {
+	case *types.Interface:
+		g.errorf(line, "%s: values of interface type %s can't be generated", g.tag, g.typeName(v.typ))
+	case *types.Basic:
+		if t.Kind() == types.Invalid {
+			g.errorf(line, "%s: the type of a value has errors", g.tag)
+		}
+	}
+}
+
+// field is a field of a struct, as seen by templates.
+type field struct {
+	name   string
+	tagged bool
+	path   []*types.Var // the field, after the embedded fields it's in
+}
+
+// fieldOf returns the path to the named field of typ, a struct, or nil. A
+// field whose name matches exactly is preferred to one whose name only
+// matches regardless of case.
+func fieldOf(typ types.Type, name string) []*types.Var {
+	var fold []*types.Var
+	for _, f := range typeFields(typ) {
+		if f.name == name {
+			return f.path
+		}
+		if fold == nil && !f.tagged && strings.EqualFold(f.name, name) {
+			fold = f.path
+		}
+	}
+	return fold
+}
+
+// typeFields returns the fields of typ, a struct, that templates can see:
+// its exported fields and those promoted from its exported embedded
+// structs, less those that are hidden.
+func typeFields(typ types.Type) []field {
+	type embedded struct {
+		typ  types.Type
+		path []*types.Var
+	}
+	var all []field
+	// taken holds the names of the fields at shallower depths, which hide
+	// those deeper, even if they hide each other.
+	taken := map[string]bool{}
+	visited := map[types.Type]bool{}
+	next := []embedded{{typ: typ}}
+	// Each pass reads the fields one level of embedding deeper.
+	for len(next) > 0 {
+		level := next
+		next = nil
+		var found []field
+		count, tags := map[string]int{}, map[string]int{}
+		for _, e := range level {
+			if visited[e.typ] {
+				continue
+			}
+			visited[e.typ] = true
+			st := e.typ.Underlying().(*types.Struct)
+			for i := 0; i < st.NumFields(); i++ {
+				f := st.Field(i)
+				if !f.Exported() {
+					continue
+				}
+				name, tagged := fieldName(f, st.Tag(i))
+				if name == "-" {
+					continue
+				}
+				path := append(e.path[:len(e.path):len(e.path)], f)
+				ft := f.Type()
+				if p, ok := ft.Underlying().(*types.Pointer); ok {
+					ft = p.Elem()
+				}
+				// An embedded struct's fields are promoted; it can
+				// also be referred to by its type's name.
+				if _, ok := ft.Underlying().(*types.Struct); ok && f.Embedded() && !tagged {
+					next = append(next, embedded{ft, path})
+				}
+				found = append(found, field{name: name, tagged: tagged, path: path})
+				count[name]++
+				if tagged {
+					tags[name]++
+				}
+			}
+		}
+		for _, f := range found {
+			if taken[f.name] {
+				continue
+			}
+			// Fields of the same name hide each other, unless only
+			// one of them is tagged.
+			if count[f.name] > 1 && (!f.tagged || tags[f.name] > 1) {
+				continue
+			}
+			all = append(all, f)
+		}
+		for _, f := range found {
+			taken[f.name] = true
+		}
+	}
+	return all
+}
+
+// fieldName returns the name of a struct field, with the given tag, and
+// whether it was given by the tag.
+func fieldName(f *types.Var, tag string) (string, bool) {
+	for _, key := range []string{"mustache", "json"} {
+		s, ok := reflect.StructTag(tag).Lookup(key)
+		if !ok {
+			continue
+		}
+		name, _, _ := strings.Cut(s, ",")
+		if key == "json" && name == "-" {
+			// Hidden from JSON, but not from templates.
+			break
+		}
+		if name != "" {
+			return name, true
+		}
+	}
+	return f.Name(), false
+}
+
+// truth returns the condition under which v, dereferenced as by indirect,
+// is true, as rollie's isTrue sees it: not the zero of its type, with
+// empty lists, maps and strings false and structs always true.
+func (g *generator) truth(v value, line int) string {
+	g.check(v, line)
+	switch t := v.typ.Underlying().(type) {
+	case *types.Array, *types.Map, *types.Slice:
+		return "len(" + v.val() + ") > 0"
+	case *types.Chan, *types.Signature:
+		return v.val() + " != nil"
+	case *types.Basic:
+		switch {
+		case t.Info()&types.IsString != 0:
+			return "len(" + v.val() + ") > 0"
+		case t.Info()&types.IsBoolean != 0:
+			if t == types.Typ[types.Bool] {
+				return v.val()
+			}
+			return "bool(" + v.val() + ")"
+		case t.Info()&types.IsNumeric != 0:
+			return v.val() + " != 0"
+		}
+	}
+	return "true"
+}
+
+// str returns the expression of the string form of v, which isn't a
+// pointer, as rollie's printableValue formats it: as fmt would, without
+// converting the value to an interface if it has no methods.
+func (g *generator) str(v value, line int) string {
+	g.check(v, line)
+	if t, ok := v.typ.Underlying().(*types.Basic); ok && exportedMethods(v.typ) == 0 {
+		switch {
+		case t.Info()&types.IsString != 0:
+			if v.typ == types.Typ[types.String] {
+				return v.val()
+			}
+			return "string(" + v.val() + ")"
+		case t.Info()&types.IsBoolean != 0:
+			g.use("strconv")
+			return "strconv.FormatBool(bool(" + v.val() + "))"
+		case t.Info()&types.IsInteger != 0 && t.Info()&types.IsUnsigned != 0:
+			g.use("strconv")
+			return "strconv.FormatUint(uint64(" + v.val() + "), 10)"
+		case t.Info()&types.IsInteger != 0:
+			g.use("strconv")
+			return "strconv.FormatInt(int64(" + v.val() + "), 10)"
+		}
+	}
+	g.use("fmt")
+	return "fmt.Sprint(" + v.val() + ")"
+}
+
+// isLambda reports whether typ is that of a lambda: func() string, for
+// variables, or func(string, func(string) string) string, for sections.
+// As for rollie, named func types aren't lambdas.
+func isLambda(typ types.Type) bool {
+	str := types.Typ[types.String]
+	render := types.NewSignatureType(nil, nil, nil, vars(str), vars(str), false)
+	return types.Identical(typ, types.NewSignatureType(nil, nil, nil, nil, vars(str), false)) ||
+		types.Identical(typ, types.NewSignatureType(nil, nil, nil, vars(str, render), vars(str), false))
+}
+
+// vars returns a tuple of unnamed variables of the types.
+func vars(typs ...types.Type) *types.Tuple {
+	vs := make([]*types.Var, len(typs))
+	for i, t := range typs {
+		vs[i] = types.NewParam(token.NoPos, nil, "", t)
+	}
+	return types.NewTuple(vs...)
+}
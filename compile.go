@@ -0,0 +1,144 @@
+// Copyright 2014 Joel Scoble (github:mohae). All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package rollie
+
+import (
+	"github.com/mohae/rollie/parse"
+)
+
+// A template is compiled, when it is first rendered, into a plan: a tree of
+// closures, one for each tag, with the nodes' types already switched on and
+// the text between tags merged into a single write per line. Each tag's
+// closure holds a memberCache for each field of its name, so that the
+// method, field index or map key that the field resolves to for the types
+// of data it is rendered with is found without a search. The closures
+// share the render state's methods with walk, so both render the same
+// output; walk remains for rendering text that isn't part of a template,
+// e.g. that returned by lambdas.
+
+// compiled is a template's plan and the tree it was compiled from.
+type compiled struct {
+	tree *parse.Tree
+	run  func(*state)
+}
+
+// plan returns t's plan, compiling it if t hasn't been compiled since its
+// tree was last set.
+func (t *Template) plan() func(*state) {
+	if c := t.compiled.Load(); c != nil && c.tree == t.Tree {
+		return c.run
+	}
+	c := &compiled{tree: t.Tree, run: compile(t.Root)}
+	t.compiled.Store(c)
+	return c.run
+}
+
+// compile returns the plan for a list of nodes. Runs of text, space and
+// carriage returns, up to and including a newline, are written at once.
+func compile(list *parse.ListNode) func(*state) {
+	var plan []func(*state)
+	var text []byte
+	// flush adds the pending text to the plan; nl is set if it ends a line.
+	flush := func(nl bool) {
+		if len(text) == 0 {
+			return
+		}
+		b := text
+		text = nil
+		plan = append(plan, func(s *state) {
+			s.write(b)
+			if nl {
+				s.pending = len(s.indent) > 0
+			}
+		})
+	}
+	for _, node := range list.Nodes {
+		switch node := node.(type) {
+		case *parse.TextNode:
+			text = append(text, node.Text...)
+		case *parse.SpaceNode:
+			text = append(text, node.Text...)
+		case *parse.CRNode:
+			text = append(text, node.Text...)
+		case *parse.NLNode:
+			text = append(text, node.Text...)
+			flush(true)
+		case *parse.CommentNode:
+			// Comments are elided.
+		default:
+			flush(false)
+			plan = append(plan, compileNode(node))
+		}
+	}
+	flush(false)
+	switch len(plan) {
+	case 0:
+		return func(*state) {}
+	case 1:
+		return plan[0]
+	}
+	return func(s *state) {
+		for _, fn := range plan {
+			fn(s)
+		}
+	}
+}
+
+// compileNode returns the plan for a tag.
+func compileNode(node parse.Node) func(*state) {
+	switch node := node.(type) {
+	case *parse.ListNode:
+		return compile(node)
+	case *parse.VariableNode:
+		cache := make([]memberCache, len(node.Ident))
+		return func(s *state) {
+			s.at(node)
+			s.walkVariable(node, cache)
+		}
+	case *parse.DotNode:
+		return func(s *state) {
+			s.at(node)
+			s.writeValue(node, s.stack[len(s.stack)-1], node.Escaped())
+		}
+	case *parse.SectionNode:
+		body := compile(node.List)
+		cache := make([]memberCache, len(node.Ident))
+		return func(s *state) {
+			s.at(node)
+			s.walkSection(node, body, cache)
+		}
+	case *parse.InvertedNode:
+		body := compile(node.List)
+		cache := make([]memberCache, len(node.Ident))
+		return func(s *state) {
+			s.at(node)
+			s.walkInverted(node, body, cache)
+		}
+	case *parse.PartialNode:
+		return func(s *state) {
+			s.at(node)
+			s.walkPartial(node)
+		}
+	case *parse.ParentNode:
+		blocks := make(map[*parse.BlockNode]func(*state))
+		for _, b := range node.Blocks() {
+			blocks[b] = compile(b.List)
+		}
+		return func(s *state) {
+			s.at(node)
+			s.walkParent(node, blocks)
+		}
+	case *parse.BlockNode:
+		body := compile(node.List)
+		return func(s *state) {
+			s.at(node)
+			s.walkBlock(node, body)
+		}
+	}
+	return func(s *state) {
+		s.at(node)
+		s.errorf("unknown node: %s", node)
+	}
+}
@@ -0,0 +1,89 @@
+// Copyright 2014 Joel Scoble (github:mohae). All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package rollie
+
+import (
+	"io"
+	"strings"
+)
+
+// Support for the render functions generated by rollie gen, see
+// cmd/rollie. A generated function holds a template's text as constants
+// and resolves its tags' names in the fields, map keys and methods of the
+// data's type when it is generated, so rendering it neither parses a
+// template nor looks up names with reflection. It writes its output and
+// reports missing names and errors with the methods of a Context, which
+// aren't meant to be called otherwise.
+
+// A Context is the state of a render by a generated render function.
+type Context struct {
+	s *state
+}
+
+// Run renders the named template to wr with fn, its generated render
+// function, using the options and escaper of t; see Template.Option and
+// Template.Escaper. It is called by generated code. The ContextualEscaper
+// can't escape generated code, as its templates aren't analyzed, so it is
+// an error.
+func Run(t *Template, name string, wr io.Writer, fn func(*Context)) (err error) {
+	defer errRecover(&err)
+	tmpl := t.New(name)
+	s := &state{tmpl: tmpl, name: name, wr: wr, escaper: tmpl.escaping()}
+	if _, ok := s.escaper.(contextualEscaper); ok {
+		s.errorf("generated code can't be escaped by the ContextualEscaper")
+	}
+	fn(&Context{s: s})
+	return
+}
+
+// Text writes text that doesn't end a line, or the value of an unescaped
+// tag.
+func (c *Context) Text(text string) {
+	c.s.writeString(text)
+}
+
+// Line writes text that ends a line.
+func (c *Context) Line(text string) {
+	c.s.writeString(text)
+	c.s.pending = len(c.s.indent) > 0
+}
+
+// Escaped writes the value of an escaped tag, escaped by the escaper.
+func (c *Context) Escaped(value string) {
+	c.s.writeString(c.s.escaper.Escape(value))
+}
+
+// Missing handles the dotted name of the tag on the given line, which
+// wasn't found, according to the missingkey option; field is the index of
+// the field that wasn't found and depth the number of contexts searched
+// for the first one. It reports whether the zero value of the map the
+// field was looked for in is to be used.
+func (c *Context) Missing(line int, name string, field, depth int) bool {
+	if c.s.tmpl.option.missingKey == mkIgnore {
+		return false
+	}
+	return c.s.missingKey(strings.Split(name, "."), line, field, depth)
+}
+
+// Error stops rendering with err, the error returned by the named method,
+// called by the tag on the given line.
+func (c *Context) Error(line int, name string, err error) {
+	c.s.errorAt(line, "calling %s: %w", name, err)
+}
+
+// Partial renders the named partial, or parent, with body. Each line of a
+// standalone partial is indented by indent.
+func (c *Context) Partial(name string, standalone bool, indent string, body func(*Context)) {
+	c.s.include(func(*state) { body(c) }, name, standalone, indent)
+}
+
+// Block renders body, a block that overrides another and is in the named
+// template.
+func (c *Context) Block(name string, body func(*Context)) {
+	old := c.s.name
+	c.s.name = name
+	body(c)
+	c.s.name = old
+}
@@ -0,0 +1,82 @@
+// Copyright 2014 Joel Scoble (github:mohae). All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package rollie
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+// renderList is what rollie gen generates, for data of type *T, for
+//
+//	{{#Friends}}
+//	  {{>item}}
+//	{{/Friends}}
+//	{{^Empty}}{{Name}}{{/Empty}}{{nope}}
+//
+// with item being "<{{Name}}>\n".
+func renderList(data *T) func(c *Context) {
+	return func(c *Context) {
+		if data != nil && len((*data).Friends) > 0 {
+			for i1 := range (*data).Friends {
+				e2 := (*data).Friends[i1]
+				c.Partial("item", true, "  ", func(c *Context) {
+					c.Text("<")
+					if e2 != nil {
+						c.Escaped((*e2).Name)
+					} else {
+						c.Escaped("")
+					}
+					c.Line(">\n")
+				})
+			}
+		}
+		t3 := false
+		if data != nil {
+			t3 = len((*data).Empty) > 0
+		}
+		if !t3 {
+			if data != nil {
+				c.Escaped((*data).Name)
+			} else {
+				c.Escaped("")
+			}
+		}
+		c.Missing(4, "nope", 0, 1)
+	}
+}
+
+func TestRun(t *testing.T) {
+	var b bytes.Buffer
+	if err := Run(New("x"), "list", &b, renderList(tVal)); err != nil {
+		t.Fatal(err)
+	}
+	want := "  <Ann>\n  <Bob>\nRollie"
+	if got := b.String(); got != want {
+		t.Errorf("expected %q, got %q", want, got)
+	}
+}
+
+func TestRunOptions(t *testing.T) {
+	err := Run(New("x").Option("missingkey=error"), "list", new(bytes.Buffer), renderList(tVal))
+	var mk *MissingKeyError
+	if !errors.As(err, &mk) || mk.Name != "list" || mk.Line != 4 || mk.Field != "nope" || mk.Depth != 1 {
+		t.Errorf("expected a MissingKeyError for nope on line 4 of list, got %v", err)
+	}
+	err = Run(New("x").Escaper(ContextualEscaper), "list", new(bytes.Buffer), renderList(tVal))
+	if err == nil {
+		t.Error("expected an error for the ContextualEscaper")
+	}
+	var b bytes.Buffer
+	tmpl := New("x").Escaper(EscaperFunc(func(s string) string { return "[" + s + "]" }))
+	if err := Run(tmpl, "list", &b, renderList(tVal)); err != nil {
+		t.Fatal(err)
+	}
+	want := "  <[Ann]>\n  <[Bob]>\n[Rollie]"
+	if got := b.String(); got != want {
+		t.Errorf("expected %q, got %q", want, got)
+	}
+}
@@ -0,0 +1,122 @@
+// Copyright 2014 Joel Scoble (github:mohae). All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package rollie
+
+import (
+	"net/url"
+	"strings"
+	"unicode/utf8"
+)
+
+// An Escaper escapes the values of escaped variable tags, {{name}}, for the
+// kind of text a template produces. Unescaped tags, {{{name}}} and
+// {{&name}}, are written as is.
+type Escaper interface {
+	Escape(s string) string
+}
+
+// The EscaperFunc type is an adapter to allow the use of ordinary
+// functions as escapers.
+type EscaperFunc func(s string) string
+
+// Escape returns f(s).
+func (f EscaperFunc) Escape(s string) string {
+	return f(s)
+}
+
+// The built-in escapers.
+var (
+	// HTMLEscaper escapes &, ", < and >, as the Mustache spec requires.
+	// It is the default.
+	HTMLEscaper Escaper = EscaperFunc(htmlReplacer.Replace)
+	// HTMLAposEscaper is HTMLEscaper that also escapes ', for values
+	// within single-quoted attributes.
+	HTMLAposEscaper Escaper = EscaperFunc(htmlAposReplacer.Replace)
+	// XMLEscaper escapes the characters that XML predefines entities for.
+	XMLEscaper Escaper = EscaperFunc(xmlReplacer.Replace)
+	// JSONEscaper escapes a value for use within a JSON string. The
+	// quotes around the string are part of the template.
+	JSONEscaper Escaper = EscaperFunc(jsonEscape)
+	// URLEscaper escapes a value for use within a URL query.
+	URLEscaper Escaper = EscaperFunc(url.QueryEscape)
+	// NoEscaper writes values as is, e.g. for plain text.
+	NoEscaper Escaper = EscaperFunc(func(s string) string { return s })
+)
+
+// escapers are the built-in escapers by their names in the escape option.
+var escapers = map[string]Escaper{
+	"html":       HTMLEscaper,
+	"htmlapos":   HTMLAposEscaper,
+	"xml":        XMLEscaper,
+	"json":       JSONEscaper,
+	"url":        URLEscaper,
+	"none":       NoEscaper,
+	"contextual": ContextualEscaper,
+}
+
+var (
+	htmlReplacer = strings.NewReplacer(
+		`&`, "&amp;",
+		`"`, "&quot;",
+		`<`, "&lt;",
+		`>`, "&gt;",
+	)
+	htmlAposReplacer = strings.NewReplacer(
+		`&`, "&amp;",
+		`"`, "&quot;",
+		`'`, "&#39;",
+		`<`, "&lt;",
+		`>`, "&gt;",
+	)
+	xmlReplacer = strings.NewReplacer(
+		`&`, "&amp;",
+		`"`, "&quot;",
+		`'`, "&apos;",
+		`<`, "&lt;",
+		`>`, "&gt;",
+	)
+)
+
+const hex = "0123456789abcdef"
+
+// jsonEscape escapes quotes, backslashes and control characters, as JSON
+// strings require, and U+2028 and U+2029, which end lines in JavaScript.
+func jsonEscape(s string) string {
+	var b strings.Builder
+	last := 0
+	for i := 0; i < len(s); {
+		r, width := utf8.DecodeRuneInString(s[i:])
+		var esc string
+		switch {
+		case r == '"':
+			esc = `\"`
+		case r == '\\':
+			esc = `\\`
+		case r == '\n':
+			esc = `\n`
+		case r == '\r':
+			esc = `\r`
+		case r == '\t':
+			esc = `\t`
+		case r < ' ':
+			esc = `\u00` + string(hex[r>>4]) + string(hex[r&0xF])
+		case r == '\u2028':
+			esc = `\u2028`
+		case r == '\u2029':
+			esc = `\u2029`
+		}
+		if esc != "" {
+			b.WriteString(s[last:i])
+			b.WriteString(esc)
+			last = i + width
+		}
+		i += width
+	}
+	if last == 0 {
+		return s
+	}
+	b.WriteString(s[last:])
+	return b.String()
+}
@@ -0,0 +1,63 @@
+// Copyright 2014 Joel Scoble (github:mohae). All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package rollie
+
+import (
+	"bytes"
+	"testing"
+)
+
+var escaperTests = []struct {
+	name    string
+	escaper Escaper
+	in      string
+	out     string
+}{
+	{"html", HTMLEscaper, `<a href="x">Tom & Jerry's</a>`, `&lt;a href=&quot;x&quot;&gt;Tom &amp; Jerry's&lt;/a&gt;`},
+	{"htmlapos", HTMLAposEscaper, `<'&'>`, `&lt;&#39;&amp;&#39;&gt;`},
+	{"xml", XMLEscaper, `<a b='c'>"&"</a>`, `&lt;a b=&apos;c&apos;&gt;&quot;&amp;&quot;&lt;/a&gt;`},
+	{"json", JSONEscaper, "say \"hi\"\\\n\t\x01\u2028é<", `say \"hi\"\\\n\t\u0001\u2028é<`},
+	{"json plain", JSONEscaper, "plain", "plain"},
+	{"json invalid", JSONEscaper, "a\xff\"", "a\xff\\\""},
+	{"url", URLEscaper, "a b&c=d/é", "a+b%26c%3Dd%2F%C3%A9"},
+	{"none", NoEscaper, `<&>`, `<&>`},
+	{"func", EscaperFunc(func(s string) string { return "[" + s + "]" }), "x", "[x]"},
+}
+
+func TestEscapers(t *testing.T) {
+	for _, test := range escaperTests {
+		if got := test.escaper.Escape(test.in); got != test.out {
+			t.Errorf("%s: expected %q, got %q", test.name, test.out, got)
+		}
+	}
+}
+
+func TestEscaper(t *testing.T) {
+	data := map[string]string{"v": `<"a">`}
+	tmpl := Must(New("page").Parse(`{{v}}{{>part}}{{{v}}}`))
+	Must(tmpl.New("part").Parse(`|{{v}}|`))
+	for _, test := range []struct {
+		name   string
+		option string
+		esc    Escaper
+		out    string
+	}{
+		{"default", "escape=default", nil, `&lt;&quot;a&quot;&gt;|&lt;&quot;a&quot;&gt;|<"a">`},
+		{"option", "escape=json", nil, `<\"a\">|<\"a\">|<"a">`},
+		// The template's escaper overrides the option and is used by
+		// its partials.
+		{"template", "escape=json", XMLEscaper, `&lt;&quot;a&quot;&gt;|&lt;&quot;a&quot;&gt;|<"a">`},
+		{"none", "escape=none", nil, `<"a">|<"a">|<"a">`},
+	} {
+		var b bytes.Buffer
+		if err := tmpl.Option(test.option).Escaper(test.esc).Render(&b, data); err != nil {
+			t.Errorf("%s: %s", test.name, err)
+			continue
+		}
+		if got := b.String(); got != test.out {
+			t.Errorf("%s: expected %q, got %q", test.name, test.out, got)
+		}
+	}
+}
@@ -0,0 +1,740 @@
+// Copyright 2014 Joel Scoble (github:mohae). All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+//
+// This code is based on code originally written by The Go Authors.
+// Their copyright notice immediately follows this one.
+
+// Copyright 2011 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package rollie
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"reflect"
+	"runtime"
+	"strconv"
+	"strings"
+
+	"github.com/mohae/rollie/parse"
+)
+
+// maxExecDepth specifies the maximum stack depth of partials; deeper
+// nesting is almost certainly a partial that includes itself.
+const maxExecDepth = 100000
+
+// state represents the state of a rendering. It's not part of the
+// template so that multiple renderings of the same template can run in
+// parallel.
+type state struct {
+	tmpl  *Template
+	name  string // the name of the template, or partial, being rendered
+	wr    io.Writer
+	node  parse.Node      // current node, for errors
+	stack []reflect.Value // the context stack; the top is the last element
+	depth int             // the height of the stack of partials
+	// indentation of standalone partials; indent is written before the
+	// next output once a line of template text has ended.
+	indent  []byte
+	pending bool
+	// blocks overriding those of the template being extended by a parent.
+	blocks  map[string]block
+	loops   []loop  // the list sections being iterated; the innermost is last
+	escaper Escaper // escapes the values of escaped tags
+	// escapes holds the escapers of the tags, and the HTML contexts of
+	// those that may be lambdas, for the ContextualEscaper; see
+	// autoescape.go.
+	escapes *escapes
+	// interpret has templates rendered by walking their parse trees rather
+	// than by running their compiled plans.
+	interpret bool
+	miss      miss // where the last lookup of a missing name failed
+}
+
+// miss is where the lookup of a name that wasn't found failed: the field
+// of the name that wasn't found, the value it wasn't found in and the
+// number of contexts searched for the first field.
+type miss struct {
+	field int
+	in    reflect.Value
+	depth int
+}
+
+// block is a block that overrides another, with its compiled plan, if any,
+// and the name of the template it is in.
+type block struct {
+	name string
+	list *parse.ListNode
+	plan func(*state)
+}
+
+// loop is the position of an iteration over a list section, for the
+// iteration markers, e.g. {{-index}}.
+type loop struct {
+	index int // 0-based index of the current element
+	len   int
+}
+
+// push pushes a new context onto the stack.
+func (s *state) push(value reflect.Value) {
+	s.stack = append(s.stack, value)
+}
+
+// pop removes the top context from the stack.
+func (s *state) pop() {
+	s.stack = s.stack[:len(s.stack)-1]
+}
+
+// at marks the state to be on node n, for error reporting.
+func (s *state) at(node parse.Node) {
+	s.node = node
+}
+
+// errorf records a RenderError and terminates processing. The error is
+// located at the line of the current node in the template, or partial,
+// being rendered.
+func (s *state) errorf(format string, args ...interface{}) {
+	s.errorAt(lineOf(s.node), format, args...)
+}
+
+// errorAt is errorf for an error on the given line; 0 if it is unknown.
+func (s *state) errorAt(line int, format string, args ...interface{}) {
+	name := s.name
+	if line > 0 {
+		name = fmt.Sprintf("%s:%d", name, line)
+	}
+	panic(RenderError{
+		Name: s.tmpl.Name(),
+		Err:  fmt.Errorf("rollie: %s: "+format, append([]interface{}{name}, args...)...),
+	})
+}
+
+// lineOf returns the line of a tag; 0 if node isn't one.
+func lineOf(node parse.Node) int {
+	switch node := node.(type) {
+	case *parse.VariableNode:
+		return node.Line
+	case *parse.DotNode:
+		return node.Line
+	case *parse.CommentNode:
+		return node.Line
+	case *parse.SectionNode:
+		return node.Line
+	case *parse.InvertedNode:
+		return node.Line
+	case *parse.PartialNode:
+		return node.Line
+	case *parse.ParentNode:
+		return node.Line
+	case *parse.BlockNode:
+		return node.Line
+	}
+	return 0
+}
+
+// RenderError is the custom error type returned when Render has an error
+// evaluating its template. (If a write error occurs, the actual error is
+// returned; it will not be of type RenderError.)
+type RenderError struct {
+	Name string // Name of template.
+	Err  error  // Pre-formatted error.
+}
+
+func (e RenderError) Error() string {
+	return e.Err.Error()
+}
+
+// Unwrap returns the underlying error, e.g. the *parse.Error of a partial
+// that failed to parse.
+func (e RenderError) Unwrap() error {
+	return e.Err
+}
+
+// MissingKeyError is the error, wrapped in a RenderError, that Render
+// returns when the missingkey option is error and the name of a variable or
+// section can't be found.
+type MissingKeyError struct {
+	Name  string   // Name of the template, or partial, the tag is in.
+	Line  int      // Line of the tag; 0 if unknown.
+	Ident []string // The tag's name, split into its fields.
+	Field string   // The field that wasn't found.
+	Index int      // The index of Field in Ident.
+	Depth int      // The number of contexts searched for the first field.
+}
+
+func (e *MissingKeyError) Error() string {
+	path := strings.Join(e.Ident, ".")
+	if e.Index > 0 {
+		return fmt.Sprintf("rollie: %s:%d: missing key %q: no %q in %q", e.Name, e.Line, path, e.Field, strings.Join(e.Ident[:e.Index], "."))
+	}
+	return fmt.Sprintf("rollie: %s:%d: missing key %q: not in any of %d contexts", e.Name, e.Line, path, e.Depth)
+}
+
+// writeError is the wrapper type used internally when Render has an error
+// writing to its output. We strip the wrapper in errRecover.
+type writeError struct {
+	Err error // Original error.
+}
+
+func (s *state) writeError(err error) {
+	panic(writeError{
+		Err: err,
+	})
+}
+
+// errRecover is the handler that turns panics into returns from the top
+// level of Render.
+func errRecover(errp *error) {
+	e := recover()
+	if e != nil {
+		switch err := e.(type) {
+		case runtime.Error:
+			panic(e)
+		case writeError:
+			*errp = err.Err // Strip the wrapper.
+		case RenderError:
+			*errp = err // Keep the wrapper.
+		default:
+			panic(e)
+		}
+	}
+}
+
+// Render applies a parsed template to the specified data object, writing
+// the output to wr. If an error occurs rendering the template or writing
+// its output, rendering stops, but partial results may already have been
+// written to the output writer.
+//
+// A template is compiled, the first time it is rendered, into a plan that
+// renders it without walking its parse tree.
+//
+// A template may be rendered safely in parallel.
+func (t *Template) Render(wr io.Writer, data interface{}) error {
+	return t.render(wr, data, false)
+}
+
+// render renders t, either by running its plan or, if interpret is set,
+// by walking its parse tree.
+func (t *Template) render(wr io.Writer, data interface{}, interpret bool) (err error) {
+	defer errRecover(&err)
+	state := &state{
+		tmpl:      t,
+		name:      t.Name(),
+		wr:        wr,
+		escaper:   t.escaping(),
+		interpret: interpret,
+	}
+	if t.Tree == nil || t.Root == nil {
+		state.errorf("%q is an incomplete or empty template", t.Name())
+	}
+	if _, ok := state.escaper.(contextualEscaper); ok {
+		state.escapes = state.contextEscapes(t)
+	}
+	state.push(reflect.ValueOf(data))
+	state.planOf(t)(state)
+	return
+}
+
+// planOf returns the function that renders tmpl, a template or one of its
+// partials, in place.
+func (s *state) planOf(tmpl *Template) func(*state) {
+	if s.interpret {
+		return func(s *state) { s.walk(tmpl.Root) }
+	}
+	return tmpl.plan()
+}
+
+// body renders the contents of a section: its plan, if it has been
+// compiled, or its list of nodes.
+func (s *state) body(list *parse.ListNode, plan func(*state)) {
+	if plan != nil {
+		plan(s)
+		return
+	}
+	s.walk(list)
+}
+
+// walk renders the node and, recursively, its children.
+func (s *state) walk(node parse.Node) {
+	s.at(node)
+	switch node := node.(type) {
+	case *parse.ListNode:
+		for _, node := range node.Nodes {
+			s.walk(node)
+		}
+	case *parse.TextNode:
+		s.write(node.Text)
+	case *parse.SpaceNode:
+		s.write(node.Text)
+	case *parse.NLNode:
+		s.write(node.Text)
+		s.pending = len(s.indent) > 0
+	case *parse.CRNode:
+		s.write(node.Text)
+	case *parse.CommentNode:
+		// Comments are elided.
+	case *parse.VariableNode:
+		s.walkVariable(node, nil)
+	case *parse.DotNode:
+		s.writeValue(node, s.stack[len(s.stack)-1], node.Escaped())
+	case *parse.SectionNode:
+		s.walkSection(node, nil, nil)
+	case *parse.InvertedNode:
+		s.walkInverted(node, nil, nil)
+	case *parse.PartialNode:
+		s.walkPartial(node)
+	case *parse.ParentNode:
+		s.walkParent(node, nil)
+	case *parse.BlockNode:
+		s.walkBlock(node, nil)
+	default:
+		s.errorf("unknown node: %s", node)
+	}
+}
+
+// write writes b to the output, preceded by any pending indentation;
+// write errors terminate processing.
+func (s *state) write(b []byte) {
+	if s.pending {
+		s.pending = false
+		s.write(s.indent)
+	}
+	if _, err := s.wr.Write(b); err != nil {
+		s.writeError(err)
+	}
+}
+
+// walkVariable renders a variable tag, escaping its value unless the tag
+// is unescaped. The value of a lambda, a func() string, is its result
+// rendered as a template with the template's initial delimiters. cache, if
+// it isn't nil, is the compiled tag's cache of members; see lookup.
+func (s *state) walkVariable(v *parse.VariableNode, cache []memberCache) {
+	val, ok := s.lookup(v.Ident, cache)
+	if !ok {
+		if val, ok = s.missing(v.Ident, v.Line); !ok {
+			return
+		}
+	}
+	s.writeValue(v, val, v.Escaped())
+}
+
+// escaperFor returns the escaper of a variable or implicit iterator tag:
+// nil, if the tag is unescaped, or the escaper for the tag's HTML context,
+// if the template's contexts have been analyzed, or the template's escaper.
+// A tag that wasn't analyzed can't be escaped for its context, so it is an
+// error.
+func (s *state) escaperFor(node parse.Node, escaped bool) Escaper {
+	if !escaped {
+		return nil
+	}
+	if s.escapes == nil {
+		return s.escaper
+	}
+	esc, ok := s.escapes.escapers[node]
+	if !ok {
+		s.errorf("%s has no escaping context", node)
+	}
+	return esc
+}
+
+// writeValue writes the string form of the value of node, a variable or
+// implicit iterator tag, escaping it if escaped is set.
+func (s *state) writeValue(node parse.Node, val reflect.Value, escaped bool) {
+	var str string
+	if fn, ok := lambda(val); ok {
+		str = s.renderString(node, fn(), s.tmpl.leftDelim, s.tmpl.rightDelim)
+	} else if v := indirect(val); v.Kind() == reflect.Func && !v.IsNil() {
+		// Only lambdas are called, and a func's address isn't output.
+		s.errorf("%s: can't print a value of type %s, which isn't a lambda", node, v.Type())
+	} else {
+		str = printableValue(val)
+	}
+	if esc := s.escaperFor(node, escaped); esc != nil {
+		str = esc.Escape(str)
+	}
+	s.writeString(str)
+}
+
+// writeString is like write, for a string.
+func (s *state) writeString(str string) {
+	if s.pending {
+		s.pending = false
+		s.write(s.indent)
+	}
+	if _, err := io.WriteString(s.wr, str); err != nil {
+		s.writeError(err)
+	}
+}
+
+// lambda returns the value as a variable lambda, a func() string, if it is
+// one.
+func lambda(val reflect.Value) (func() string, bool) {
+	if indirect(val).Kind() != reflect.Func {
+		return nil, false
+	}
+	fn, ok := valueInterface(val).(func() string)
+	return fn, ok && fn != nil
+}
+
+// sectionLambda returns the value as a section lambda, a func(text string,
+// render func(string) string) string, if it is one.
+func sectionLambda(val reflect.Value) (func(string, func(string) string) string, bool) {
+	if indirect(val).Kind() != reflect.Func {
+		return nil, false
+	}
+	fn, ok := valueInterface(val).(func(string, func(string) string) string)
+	return fn, ok && fn != nil
+}
+
+// walkSection renders the section once for each element of a non-empty
+// list, or once with the value pushed onto the context stack for any other
+// truthy value. A lambda, a func(text string, render func(string) string)
+// string, is passed the unrendered section and a function that renders text
+// with the section's delimiters; its result is written as is. The contents
+// are rendered by plan, if it isn't nil, and cache is as for walkVariable.
+func (s *state) walkSection(sec *parse.SectionNode, plan func(*state), cache []memberCache) {
+	val, ok := s.lookup(sec.Ident, cache)
+	if !ok {
+		if val, ok = s.missing(sec.Ident, sec.Line); !ok {
+			return
+		}
+	}
+	if fn, ok := sectionLambda(val); ok {
+		s.writeString(fn(sec.Text, func(text string) string {
+			return s.renderString(sec, text, sec.LeftDelim, sec.RightDelim)
+		}))
+		return
+	}
+	if !isTrue(val) {
+		return
+	}
+	val = indirect(val)
+	switch val.Kind() {
+	case reflect.Array, reflect.Slice:
+		s.loops = append(s.loops, loop{len: val.Len()})
+		for i := 0; i < val.Len(); i++ {
+			s.loops[len(s.loops)-1].index = i
+			s.push(val.Index(i))
+			s.body(sec.List, plan)
+			s.pop()
+		}
+		s.loops = s.loops[:len(s.loops)-1]
+	case reflect.Bool:
+		// A true boolean doesn't provide a new context.
+		s.body(sec.List, plan)
+	default:
+		s.push(val)
+		s.body(sec.List, plan)
+		s.pop()
+	}
+}
+
+// walkInverted renders the section only if its value is missing, false or
+// an empty list. plan and cache are as for walkSection.
+func (s *state) walkInverted(inv *parse.InvertedNode, plan func(*state), cache []memberCache) {
+	val, ok := s.lookup(inv.Ident, cache)
+	if ok && isTrue(val) {
+		return
+	}
+	s.body(inv.List, plan)
+}
+
+// walkPartial renders the partial with the current context.
+func (s *state) walkPartial(p *parse.PartialNode) {
+	if tmpl := s.partial(p.Ident); tmpl != nil {
+		s.include(s.planOf(tmpl), tmpl.Name(), p.Standalone, p.Indent)
+	}
+}
+
+// walkParent renders the parent template with the blocks within the parent
+// tag overriding its own. Blocks that are already overridden, by a template
+// that extends this one, keep their overrides. plans holds the compiled
+// blocks, if any.
+func (s *state) walkParent(p *parse.ParentNode, plans map[*parse.BlockNode]func(*state)) {
+	tmpl := s.partial(p.Ident)
+	if tmpl == nil {
+		return
+	}
+	blocks := s.blocks
+	s.blocks = make(map[string]block, len(blocks))
+	for name, b := range blocks {
+		s.blocks[name] = b
+	}
+	for _, b := range p.Blocks() {
+		if _, ok := s.blocks[b.Name]; !ok {
+			s.blocks[b.Name] = block{name: s.name, list: b.List, plan: plans[b]}
+		}
+	}
+	s.include(s.planOf(tmpl), tmpl.Name(), p.Standalone, p.Indent)
+	s.blocks = blocks
+}
+
+// walkBlock renders the block's override, if it has one, or its default
+// content, which is rendered by plan if it isn't nil.
+func (s *state) walkBlock(b *parse.BlockNode, plan func(*state)) {
+	if o, ok := s.blocks[b.Name]; ok {
+		name := s.name
+		s.name = o.name
+		s.body(o.list, o.plan)
+		s.name = name
+		return
+	}
+	s.body(b.List, plan)
+}
+
+// partial returns the named partial, or parent, template. Missing partials
+// render as the empty string, so nil is returned, unless the missingpartial
+// option is set to error.
+func (s *state) partial(name string) *Template {
+	tmpl, err := s.tmpl.partial(name)
+	if err != nil {
+		s.errorf("%w", err)
+	}
+	if tmpl == nil || tmpl.Tree == nil {
+		if s.tmpl.option.missingPartial == mpError {
+			s.errorf("partial %q not found", name)
+		}
+		return nil
+	}
+	return tmpl
+}
+
+// include renders the named partial or parent, by its plan, in place. Each
+// line of a standalone include is indented by indent.
+func (s *state) include(plan func(*state), name string, standalone bool, indent string) {
+	if s.depth >= maxExecDepth {
+		s.errorf("exceeded maximum partial depth (%v)", maxExecDepth)
+	}
+	s.depth++
+	oldName, oldNode := s.name, s.node
+	s.name = name
+	old := s.indent
+	if standalone {
+		// Every line of a standalone partial is indented by the tag's
+		// indentation in addition to that of the partials it is in.
+		s.indent = append(old[:len(old):len(old)], indent...)
+		s.pending = len(s.indent) > 0
+	} else {
+		// An inline partial continues the current line and its own
+		// lines aren't indented.
+		if s.pending {
+			s.write(nil)
+		}
+		s.indent = nil
+	}
+	plan(s)
+	s.name, s.node = oldName, oldNode
+	s.indent = old
+	s.pending = standalone && len(s.indent) > 0
+	s.depth--
+}
+
+// renderString parses text, using the passed delimiters, and renders it
+// with the current context stack. It expands the text produced by lambdas;
+// node is the tag of the lambda, whose HTML context the text is analyzed
+// in, for the ContextualEscaper.
+func (s *state) renderString(node parse.Node, text, leftDelim, rightDelim string) string {
+	tree, err := parse.Parse(s.name, text, leftDelim, rightDelim)
+	if err != nil {
+		s.errorf("lambda: %w", err)
+	}
+	var b bytes.Buffer
+	state := *s
+	state.wr = &b
+	state.indent, state.pending = nil, false
+	if s.escapes != nil {
+		state.escapes = s.lambdaEscapes(node, tree)
+	}
+	state.walk(tree.Root)
+	return b.String()
+}
+
+// lookup resolves the name against the context stack. The first field of a
+// dotted name is searched for from the top of the stack down; the remaining
+// fields are resolved within the value that was found, so a missing field
+// does not fall back to contexts lower in the stack. It reports whether the
+// name was found. The implicit iterator, ".", is the top of the stack; the
+// iteration markers are provided by the innermost list section. cache, if
+// it isn't nil, holds a memberCache for each field of the name. Where the
+// lookup of a name that isn't found failed is recorded in s.miss.
+func (s *state) lookup(ident []string, cache []memberCache) (reflect.Value, bool) {
+	top := s.stack[len(s.stack)-1]
+	if len(ident) == 1 {
+		switch ident[0] {
+		case ".":
+			return top, true
+		case "-index", "-first", "-last", "-odd":
+			v, ok := s.marker(ident[0])
+			if !ok {
+				s.miss = miss{0, top, len(s.stack)}
+			}
+			return v, ok
+		}
+	}
+	for i := len(s.stack) - 1; i >= 0; i-- {
+		v, ok := s.lookupName(s.stack[i], ident[0], cacheOf(cache, 0))
+		if !ok {
+			continue
+		}
+		for j := 1; j < len(ident); j++ {
+			in := v
+			if v, ok = s.lookupName(v, ident[j], cacheOf(cache, j)); !ok {
+				s.miss = miss{j, in, len(s.stack) - i}
+				return reflect.Value{}, false
+			}
+		}
+		return v, true
+	}
+	s.miss = miss{0, top, len(s.stack)}
+	return reflect.Value{}, false
+}
+
+// cacheOf returns the ith memberCache of cache, or nil if there is none.
+func cacheOf(cache []memberCache, i int) *memberCache {
+	if cache == nil {
+		return nil
+	}
+	return &cache[i]
+}
+
+// missing handles a name, on the given line, that lookup has just failed
+// to find, according to the missingkey option. It returns the value to use,
+// if any.
+func (s *state) missing(ident []string, line int) (reflect.Value, bool) {
+	if s.tmpl.option.missingKey == mkIgnore {
+		return reflect.Value{}, false
+	}
+	in := s.miss.in
+	if !s.missingKey(ident, line, s.miss.field, s.miss.depth) {
+		return reflect.Value{}, false
+	}
+	if in = indirect(in); in.Kind() == reflect.Map {
+		return reflect.Zero(in.Type().Elem()), true
+	}
+	return reflect.Value{}, false
+}
+
+// missingKey applies the missingkey option to a name that wasn't found,
+// where field is the index of the field that wasn't found and depth the
+// number of contexts searched for the first one. It reports whether the
+// zero value of the map the field was looked for in is to be used.
+func (s *state) missingKey(ident []string, line, field, depth int) bool {
+	switch s.tmpl.option.missingKey {
+	case mkError:
+		panic(RenderError{
+			Name: s.tmpl.Name(),
+			Err: &MissingKeyError{
+				Name:  s.name,
+				Line:  line,
+				Ident: ident,
+				Field: ident[field],
+				Index: field,
+				Depth: depth,
+			},
+		})
+	case mkZero:
+		return true
+	}
+	return false
+}
+
+// marker returns the value of an iteration marker for the innermost list
+// section: -index is the 1-based index of the element; -first, -last and
+// -odd report whether the element is the first, the last, or has an odd
+// -index. Outside of a list section -index is missing and the others are
+// false.
+func (s *state) marker(name string) (reflect.Value, bool) {
+	if len(s.loops) == 0 {
+		if name == "-index" {
+			return reflect.Value{}, false
+		}
+		return reflect.ValueOf(false), true
+	}
+	l := s.loops[len(s.loops)-1]
+	switch name {
+	case "-index":
+		return reflect.ValueOf(l.index + 1), true
+	case "-first":
+		return reflect.ValueOf(l.index == 0), true
+	case "-last":
+		return reflect.ValueOf(l.index == l.len-1), true
+	}
+	return reflect.ValueOf(l.index%2 == 0), true
+}
+
+// indirect returns the value, after dereferencing as many times as
+// necessary to reach the base type (or nil).
+func indirect(v reflect.Value) reflect.Value {
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return reflect.Value{}
+		}
+		v = v.Elem()
+	}
+	return v
+}
+
+// isTrue reports whether the value is 'true', in the sense of not the zero
+// of its type, and whether the value has a meaningful truth value. Empty
+// lists, maps and strings are false; structs are always true.
+func isTrue(val reflect.Value) bool {
+	val = indirect(val)
+	if !val.IsValid() {
+		return false
+	}
+	switch val.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return val.Len() > 0
+	case reflect.Bool:
+		return val.Bool()
+	case reflect.Complex64, reflect.Complex128:
+		return val.Complex() != 0
+	case reflect.Chan, reflect.Func:
+		return !val.IsNil()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return val.Int() != 0
+	case reflect.Float32, reflect.Float64:
+		return val.Float() != 0
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return val.Uint() != 0
+	}
+	return true
+}
+
+// valueInterface returns the value as an interface{}, after dereferencing,
+// or nil if there is none.
+func valueInterface(v reflect.Value) interface{} {
+	v = indirect(v)
+	if !v.IsValid() || !v.CanInterface() {
+		return nil
+	}
+	return v.Interface()
+}
+
+// printableValue returns the string form of the value; missing and nil
+// values, including nil funcs, print as the empty string.
+func printableValue(v reflect.Value) string {
+	v = indirect(v)
+	if !v.IsValid() || v.Kind() == reflect.Func && v.IsNil() {
+		return ""
+	}
+	// Values without methods, which might format them, print as fmt would
+	// without the cost of converting them to an interface.
+	if v.NumMethod() == 0 {
+		switch v.Kind() {
+		case reflect.String:
+			return v.String()
+		case reflect.Bool:
+			return strconv.FormatBool(v.Bool())
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			return strconv.FormatInt(v.Int(), 10)
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+			return strconv.FormatUint(v.Uint(), 10)
+		}
+	}
+	return fmt.Sprint(v.Interface())
+}
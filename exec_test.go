@@ -0,0 +1,435 @@
+// Copyright 2014 Joel Scoble (github:mohae). All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package rollie
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+)
+
+type T struct {
+	Name    string
+	Count   int
+	Admin   bool
+	Items   []string
+	Friends []*Person
+	Person  Person
+	PPerson *Person
+	Empty   []int
+	Any     interface{}
+	Map     map[string]interface{}
+	private string
+}
+
+type Person struct {
+	Name string
+	Age  int
+}
+
+func (p Person) Greeting() string { return "Hi " + p.Name }
+
+func (p *Person) Older() int { return p.Age + 1 }
+
+func (p Person) Pair(s string) string { return s + p.Name }
+
+var tVal = &T{
+	Name:    "Rollie",
+	Count:   3,
+	Admin:   true,
+	Items:   []string{"a", "b"},
+	Friends: []*Person{{"Ann", 30}, {"Bob", 40}},
+	Person:  Person{"Carl", 50},
+	PPerson: &Person{"Dee", 60},
+	Any:     &Person{"Eve", 70},
+	Map:     map[string]interface{}{"one": 1, "html": "<b>"},
+	private: "hidden",
+}
+
+type renderTest struct {
+	name   string
+	input  string
+	output string
+	data   interface{}
+	ok     bool
+}
+
+var renderTests = []renderTest{
+	{"empty", "", "", nil, true},
+	{"text", "some text\r\n", "some text\r\n", tVal, true},
+	{"comment", "a{{!comment}}b", "ab", tVal, true},
+	{"struct field", "Hi {{Name}}!", "Hi Rollie!", tVal, true},
+	{"struct field lower", "Hi {{name}}!", "Hi Rollie!", tVal, true},
+	{"unexported field", "[{{private}}]", "[]", tVal, true},
+	{"int", "{{Count}}", "3", tVal, true},
+	{"missing", "[{{nope}}]", "[]", tVal, true},
+	{"nil data", "[{{nope}}]", "[]", nil, true},
+	{"map", "{{one}}", "1", map[string]int{"one": 1}, true},
+	{"escaped", "{{x}}", "&amp; &quot; &lt; &gt; '", map[string]string{"x": `& " < > '`}, true},
+	{"unescaped", "{{{x}}} {{&x}}", "<b> <b>", map[string]string{"x": "<b>"}, true},
+	{"bool section", "{{#Admin}}admin{{/Admin}}", "admin", tVal, true},
+	{"false section", "{{#a}}x{{/a}}", "", map[string]bool{"a": false}, true},
+	{"list section", "{{#Items}}<{{Name}}>{{/Items}}", "<Rollie><Rollie>", tVal, true},
+	{"struct list", "{{#Friends}}{{Name}}:{{Age}},{{/Friends}}", "Ann:30,Bob:40,", tVal, true},
+	{"empty list", "{{#Empty}}x{{/Empty}}", "", tVal, true},
+	{"struct section", "{{#Person}}{{Name}}{{/Person}}", "Carl", tVal, true},
+	{"pointer section", "{{#PPerson}}{{Name}} {{Count}}{{/PPerson}}", "Dee 3", tVal, true},
+	{"interface section", "{{#Any}}{{Name}}{{/Any}}", "Eve", tVal, true},
+	{"map section", "{{#Map}}{{one}}{{{html}}}{{/Map}}", "1<b>", tVal, true},
+	{"inverted missing", "{{^nope}}none{{/nope}}", "none", tVal, true},
+	{"inverted empty", "{{^Empty}}none{{/Empty}}", "none", tVal, true},
+	{"inverted true", "{{^Admin}}none{{/Admin}}", "", tVal, true},
+	{"dot", "{{#Items}}<{{.}}>{{/Items}}", "<a><b>", tVal, true},
+	{"dot escaped", "{{#list}}{{.}}{{{.}}}{{& . }}{{/list}}", "&lt;<<", map[string][]string{"list": {"<"}}, true},
+	{"dot root", "{{#.}}{{Name}}{{/.}}", "Rollie", tVal, true},
+	{"dotted field", "{{Person.Name}} {{pperson.age}}", "Carl 60", tVal, true},
+	{"dotted map", "{{Map.one}}", "1", tVal, true},
+	{"dotted missing", "[{{Person.nope}}]", "[]", tVal, true},
+	{"dotted first field", "{{#Person}}[{{Map.one}}][{{Person.Age}}]{{/Person}}", "[1][50]", tVal, true},
+	{"dotted no masking", "{{#c}}[{{a.b}}]{{/c}}", "[]", map[string]interface{}{
+		"a": map[string]int{"b": 1},
+		"c": map[string]interface{}{"a": map[string]int{}},
+	}, true},
+	{"dotted section", "{{#Person.Name}}{{.}}{{/Person.Name}}", "Carl", tVal, true},
+	{"method", "{{Person.Greeting}}", "Hi Carl", tVal, true},
+	{"pointer method", "{{PPerson.Older}} {{#Friends}}{{older}}{{/Friends}}", "61 3141", tVal, true},
+	{"addressable pointer method", "{{Person.Older}}", "51", tVal, true},
+	{"method with args", "[{{Person.Pair}}]", "[]", tVal, true},
+	{"index", "{{#Items}}{{-index}}:{{.}} {{/Items}}", "1:a 2:b ", tVal, true},
+	{"first last", "{{#Friends}}{{#-first}}[{{/-first}}{{Name}}{{^-last}}, {{/-last}}{{#-last}}]{{/-last}}{{/Friends}}", "[Ann, Bob]", tVal, true},
+	{"odd", "{{#list}}{{#-odd}}o{{/-odd}}{{^-odd}}e{{/-odd}}{{/list}}", "oeo", map[string][]int{"list": {1, 2, 3}}, true},
+	{"nested index", "{{#Friends}}{{#Person}}{{-index}}{{/Person}}{{/Friends}}", "12", tVal, true},
+	{"inner list index", "{{#Friends}}{{#list}}{{-index}}{{/list}}|{{-index}} {{/Friends}}", "12|1 12|2 ", map[string]interface{}{
+		"Friends": []int{1, 2}, "list": []int{1, 2},
+	}, true},
+	{"markers outside list", "[{{-index}}{{#-first}}x{{/-first}}{{^-last}}y{{/-last}}]", "[y]", tVal, true},
+	{"literal", `{{#Items}}{{"{{}} .Values.{{.}}}} {{/Items}}`, "{{ .Values.a}} {{ .Values.b}} ", tVal, true},
+	{"nested", "{{#Friends}}{{#Admin}}{{Name}}{{/Admin}}{{/Friends}}", "AnnBob", tVal, true},
+	{"missing partial", "[{{>nope}}]", "[]", tVal, true},
+	{"lambda", "{{f}} {{{f}}}", "&lt;Rollie&gt; <Rollie>", map[string]interface{}{
+		"name": "Rollie",
+		"f":    func() string { return "<{{name}}>" },
+	}, true},
+	{"section lambda", "{{=| |=}}|#f|x |name||/f|", "<x Rollie>", map[string]interface{}{
+		"name": "Rollie",
+		"f":    func(text string, render func(string) string) string { return "<" + render(text) + ">" },
+	}, true},
+	{"lambda parse error", "{{f}}", "", map[string]interface{}{
+		"f": func() string { return "{{#x}}" },
+	}, false},
+	{"func", "{{f}}", "", map[string]interface{}{
+		"f": func(int) string { return "" },
+	}, false},
+	{"nil func", "[{{f}}{{.}}]", "[]", (func() string)(nil), true},
+}
+
+func TestRender(t *testing.T) {
+	testRenderTests(t, false)
+}
+
+// TestRenderInterpreted runs the render tests by walking the parse trees
+// rather than running the compiled plans.
+func TestRenderInterpreted(t *testing.T) {
+	testRenderTests(t, true)
+}
+
+func testRenderTests(t *testing.T, interpret bool) {
+	b := new(bytes.Buffer)
+	for _, test := range renderTests {
+		tmpl, err := New(test.name).Parse(test.input)
+		if err != nil {
+			t.Errorf("%s: parse error: %s", test.name, err)
+			continue
+		}
+		b.Reset()
+		err = tmpl.render(b, test.data, interpret)
+		switch {
+		case !test.ok && err == nil:
+			t.Errorf("%s: expected error; got none", test.name)
+			continue
+		case test.ok && err != nil:
+			t.Errorf("%s: unexpected render error: %s", test.name, err)
+			continue
+		case !test.ok && err != nil:
+			// expected error, got one
+			continue
+		}
+		if b.String() != test.output {
+			t.Errorf("%s: expected\n\t%q\ngot\n\t%q", test.name, test.output, b.String())
+		}
+	}
+}
+
+func TestRenderPartial(t *testing.T) {
+	tmpl := Must(New("page").Parse("<{{>item}}>"))
+	Must(tmpl.New("item").Parse("{{#Friends}}{{Name}}{{/Friends}}"))
+	b := new(bytes.Buffer)
+	if err := tmpl.Render(b, tVal); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := b.String(), "<AnnBob>"; got != want {
+		t.Errorf("expected %q, got %q", want, got)
+	}
+}
+
+// TestRenderManyTypes renders a tag with more types of data than its
+// compiled plan caches members for, in parallel.
+func TestRenderManyTypes(t *testing.T) {
+	type named struct {
+		NAME string
+	}
+	tmpl := Must(New("types").Parse("{{#list}}{{name}},{{/list}}"))
+	data := map[string]interface{}{"list": []interface{}{
+		map[string]interface{}{"name": "a"},
+		map[string]string{"name": "b"},
+		Person{"c", 1},
+		&Person{"d", 2},
+		named{"e"},
+		&named{"f"},
+		map[string]int{"other": 1},
+		"g",
+	}}
+	want := "a,b,c,d,e,f,,,"
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var b strings.Builder
+			if err := tmpl.Render(&b, data); err != nil {
+				t.Error(err)
+			} else if b.String() != want {
+				t.Errorf("expected %q, got %q", want, b.String())
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestRenderEmptyTemplate(t *testing.T) {
+	err := New("empty").Render(new(bytes.Buffer), nil)
+	if err == nil {
+		t.Fatal("expected error for unparsed template; got none")
+	}
+	if _, ok := err.(RenderError); !ok {
+		t.Errorf("expected RenderError, got %T", err)
+	}
+}
+
+type errorWriter struct{}
+
+var errWrite = errors.New("write error")
+
+func (errorWriter) Write([]byte) (int, error) {
+	return 0, errWrite
+}
+
+func TestRenderWriteError(t *testing.T) {
+	tmpl := Must(Parse("write", "text"))
+	if err := tmpl.Render(errorWriter{}, nil); err != errWrite {
+		t.Errorf("expected %v, got %v", errWrite, err)
+	}
+}
+
+func TestRenderErrorLocation(t *testing.T) {
+	tmpl := Must(New("page").Option("missingpartial=error").Parse("a\n{{>part}}\n{{<parent}}{{$b}}\n\n{{>none}}{{/b}}{{/parent}}"))
+	Must(tmpl.New("part").Parse("one\ntwo\n{{>nope}}"))
+	Must(tmpl.New("parent").Parse("{{$b}}{{/b}}"))
+	for _, interpret := range []bool{false, true} {
+		err := tmpl.render(new(bytes.Buffer), nil, interpret)
+		want := `rollie: part:3: partial "nope" not found`
+		if err == nil || err.Error() != want {
+			t.Errorf("expected error %q, got %v", want, err)
+		}
+	}
+	Must(tmpl.New("part").Parse("two"))
+	err := tmpl.Render(new(bytes.Buffer), nil)
+	want := `rollie: page:5: partial "none" not found`
+	if err == nil || err.Error() != want {
+		t.Errorf("expected error %q, got %v", want, err)
+	}
+}
+
+func TestRenderPartialIndent(t *testing.T) {
+	tmpl := Must(New("page").Parse("<ul>\n  {{>list}}\n</ul>\n"))
+	Must(tmpl.New("list").Parse("{{#Items}}\n  {{>item}}\n{{/Items}}\n"))
+	Must(tmpl.New("item").Parse("<li>{{Name}}</li>\n"))
+	b := new(bytes.Buffer)
+	if err := tmpl.Render(b, tVal); err != nil {
+		t.Fatal(err)
+	}
+	want := "<ul>\n    <li>Rollie</li>\n    <li>Rollie</li>\n</ul>\n"
+	if got := b.String(); got != want {
+		t.Errorf("expected %q, got %q", want, got)
+	}
+}
+
+func TestDelims(t *testing.T) {
+	tmpl := New("page").Delims("<%", "%>").Loader(MapLoader{
+		"loaded": "<%Name%>{{Name}}",
+	})
+	Must(tmpl.New("assoc").Parse("[<%Count%>]"))
+	Must(tmpl.Parse("{{Name}} <%Name%> <%>assoc%> <%>loaded%> <%=| |=%>|Name|"))
+	b := new(bytes.Buffer)
+	if err := tmpl.Render(b, tVal); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := b.String(), "{{Name}} Rollie [3] Rollie{{Name}} Rollie"; got != want {
+		t.Errorf("expected %q, got %q", want, got)
+	}
+}
+
+func TestRenderParent(t *testing.T) {
+	tmpl := Must(New("page").Parse("{{<layout}}{{$title}}{{Name}}{{/title}}{{/layout}}"))
+	Must(tmpl.New("layout").Parse("<h1>{{$title}}Default{{/title}}</h1>\n{{$body}}\n  {{>body}}\n{{/body}}"))
+	Must(tmpl.New("body").Parse("<p>{{$title}}{{/title}}</p>\n"))
+	b := new(bytes.Buffer)
+	if err := tmpl.Render(b, tVal); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := b.String(), "<h1>Rollie</h1>\n  <p>Rollie</p>\n"; got != want {
+		t.Errorf("expected %q, got %q", want, got)
+	}
+}
+
+var missingKeyTests = []struct {
+	name  string
+	input string
+	ident string
+	field string
+	index int
+	line  int
+	depth int
+}{
+	{"variable", "a\n{{nope}}", "nope", "nope", 0, 2, 1},
+	{"section", "{{#nope}}x{{/nope}}", "nope", "nope", 0, 1, 1},
+	{"field", "{{PPerson.nope}}", "PPerson.nope", "nope", 1, 1, 1},
+	{"deep field", "{{#Friends}}\n\n{{Person.Name.x}}{{/Friends}}", "Person.Name.x", "x", 2, 3, 2},
+	{"stack", "{{#Friends}}{{nope}}{{/Friends}}", "nope", "nope", 0, 1, 2},
+}
+
+func TestMissingKeyOption(t *testing.T) {
+	for _, test := range missingKeyTests {
+		tmpl := Must(New(test.name).Parse(test.input))
+		if err := tmpl.Render(new(bytes.Buffer), tVal); err != nil {
+			t.Errorf("%s: ignore: %s", test.name, err)
+		}
+		err := tmpl.Option("missingkey=error").Render(new(bytes.Buffer), tVal)
+		var merr *MissingKeyError
+		if !errors.As(err, &merr) {
+			t.Errorf("%s: expected MissingKeyError, got %v", test.name, err)
+			continue
+		}
+		if merr.Name != test.name || strings.Join(merr.Ident, ".") != test.ident || merr.Field != test.field || merr.Index != test.index || merr.Line != test.line || merr.Depth != test.depth {
+			t.Errorf("%s: expected %s:%d %s, %s, %d, %d; got %s:%d %s, %s, %d, %d", test.name,
+				test.name, test.line, test.ident, test.field, test.index, test.depth,
+				merr.Name, merr.Line, strings.Join(merr.Ident, "."), merr.Field, merr.Index, merr.Depth)
+		}
+	}
+}
+
+// TestMissingKeyErrorRepeated checks that the error for a field that has
+// the name of an earlier one reports the field that wasn't found.
+func TestMissingKeyErrorRepeated(t *testing.T) {
+	tmpl := Must(New("repeat").Option("missingkey=error").Parse("{{a.a}}"))
+	err := tmpl.Render(new(bytes.Buffer), map[string]interface{}{"a": map[string]interface{}{"b": 1}})
+	want := `rollie: repeat:1: missing key "a.a": no "a" in "a"`
+	if err == nil || err.Error() != want {
+		t.Errorf("expected %q, got %v", want, err)
+	}
+}
+
+func TestMissingKeyOptionPartial(t *testing.T) {
+	tmpl := Must(New("page").Option("missingkey=error").Parse("{{>item}}"))
+	Must(tmpl.New("item").Parse("\n{{^nope}}inverted sections don't error{{/nope}}{{nope}}"))
+	err := tmpl.Render(new(bytes.Buffer), tVal)
+	want := `rollie: item:2: missing key "nope": not in any of 1 contexts`
+	if err == nil || err.Error() != want {
+		t.Errorf("expected error %q, got %v", want, err)
+	}
+}
+
+func TestMissingKeyOptionZero(t *testing.T) {
+	tmpl := Must(New("zero").Option("missingkey=zero").Parse("[{{a}}][{{b}}][{{c.d}}]{{#e}}e{{/e}}"))
+	data := map[string]interface{}{"a": 1}
+	testRender(t, tmpl, map[string]int{"a": 1}, "[1][0][0]")
+	testRender(t, tmpl, data, "[1][][]")
+	testRender(t, tmpl, tVal, "[][][]")
+}
+
+type counter struct{ calls int }
+
+func (c *counter) Next() map[string]int {
+	c.calls++
+	return map[string]int{"calls": c.calls}
+}
+
+// TestMissingKeyOptionCalls checks that the methods on the path to a
+// missing key are called only once.
+func TestMissingKeyOptionCalls(t *testing.T) {
+	for _, option := range []string{"missingkey=zero", "missingkey=error"} {
+		c := &counter{}
+		tmpl := Must(New("calls").Option(option).Parse("[{{next.nope}}]"))
+		err := tmpl.Render(new(bytes.Buffer), c)
+		var merr *MissingKeyError
+		if option == "missingkey=error" && (!errors.As(err, &merr) || merr.Field != "nope") {
+			t.Errorf("%s: expected MissingKeyError for nope, got %v", option, err)
+		}
+		if c.calls != 1 {
+			t.Errorf("%s: expected 1 call of Next, got %d", option, c.calls)
+		}
+	}
+}
+
+// benchData and benchTemplate are a typical page: a list of structs,
+// nested sections and partials.
+var benchData = map[string]interface{}{
+	"Title": "Rollie",
+	"User":  &Person{"Ann", 30},
+	"Items": func() []*Person {
+		var p []*Person
+		for i := 0; i < 100; i++ {
+			p = append(p, &Person{"Bob", i})
+		}
+		return p
+	}(),
+}
+
+const benchTemplate = `<html>
+<head><title>{{Title}}</title></head>
+<body>
+  {{>header}}
+  <ul>
+  {{#Items}}
+    <li class="{{#-odd}}odd{{/-odd}}">{{-index}}. {{Name}} is {{Age}} &mdash; {{User.Name}}</li>
+  {{/Items}}
+  </ul>
+  {{^Items}}none{{/Items}}
+</body>
+</html>
+`
+
+func benchmarkRender(b *testing.B, interpret bool) {
+	tmpl := Must(New("bench").Parse(benchTemplate))
+	Must(tmpl.New("header").Parse("<h1>Hello {{User.Name}}</h1>\n"))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := tmpl.render(io.Discard, benchData, interpret); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkRender(b *testing.B) {
+	benchmarkRender(b, false)
+}
+
+func BenchmarkRenderInterpreted(b *testing.B) {
+	benchmarkRender(b, true)
+}
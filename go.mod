@@ -0,0 +1,3 @@
+module github.com/mohae/rollie
+
+go 1.22
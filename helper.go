@@ -0,0 +1,131 @@
+// Copyright 2014 Joel Scoble (github:mohae). All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+//
+// This code is based on code originally written by The Go Authors.
+// Their copyright notice immediately follows this one.
+
+// Copyright 2011 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Helper functions to make constructing templates easier.
+
+package rollie
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Functions and methods to parse templates.
+
+// templateName returns the name a template file is registered under: its
+// base name without the extension, e.g. "partials/header.mustache" is
+// "header". This is the name used to refer to it as a partial.
+func templateName(filename string) string {
+	name := filepath.Base(filename)
+	return strings.TrimSuffix(name, filepath.Ext(name))
+}
+
+// ParseFile creates a new Template and parses the template definition from
+// the named file. The returned template's name is the file's base name
+// without its extension.
+func ParseFile(filename string) (*Template, error) {
+	return parseFiles(nil, filename)
+}
+
+// ParseFiles creates a new Template and parses the template definitions
+// from the named files. The returned template's name will be that of the
+// first file, without its extension. There must be at least one file. All
+// of the files are associated with each other so that any of them may be
+// rendered as a partial by any other, e.g. "header.mustache" is rendered
+// by {{>header}}.
+//
+// When parsing multiple files with the same name in different
+// directories, the last one mentioned will be the one that results.
+func ParseFiles(filenames ...string) (*Template, error) {
+	return parseFiles(nil, filenames...)
+}
+
+// ParseFiles parses the named files and associates the resulting templates
+// with t. If an error occurs, parsing stops and the returned template is
+// nil; otherwise it is t. There must be at least one file.
+func (t *Template) ParseFiles(filenames ...string) (*Template, error) {
+	t.init()
+	return parseFiles(t, filenames...)
+}
+
+// parseFiles is the helper for the method and function. If the argument
+// template is nil, it is created from the first file.
+func parseFiles(t *Template, filenames ...string) (*Template, error) {
+	if len(filenames) == 0 {
+		// Not really a problem, but be consistent.
+		return nil, fmt.Errorf("rollie: no files named in call to ParseFiles")
+	}
+	for _, filename := range filenames {
+		b, err := os.ReadFile(filename)
+		if err != nil {
+			return nil, err
+		}
+		name := templateName(filename)
+		// First template becomes return value if not already defined,
+		// and we use that one for subsequent New calls to associate
+		// all the templates together.
+		var tmpl *Template
+		if t == nil {
+			t = New(name)
+		}
+		if name == t.Name() {
+			tmpl = t
+		} else {
+			tmpl = t.New(name)
+		}
+		if _, err = tmpl.ParseBytes(b); err != nil {
+			return nil, err
+		}
+	}
+	return t, nil
+}
+
+// ParseGlob creates a new Template and parses the template definitions
+// from the files identified by the pattern, which must match at least one
+// file. The files are matched according to the semantics of
+// filepath.Match. The returned template has the name of the first file
+// matched by the pattern, without its extension.
+func ParseGlob(pattern string) (*Template, error) {
+	return parseGlob(nil, pattern)
+}
+
+// ParseGlob parses the template definitions in the files identified by the
+// pattern and associates the resulting templates with t.
+func (t *Template) ParseGlob(pattern string) (*Template, error) {
+	t.init()
+	return parseGlob(t, pattern)
+}
+
+// parseGlob is the implementation of the function and method ParseGlob.
+func parseGlob(t *Template, pattern string) (*Template, error) {
+	filenames, err := filepath.Glob(pattern)
+	if err != nil {
+		return nil, err
+	}
+	if len(filenames) == 0 {
+		return nil, fmt.Errorf("rollie: pattern matches no files: %#q", pattern)
+	}
+	return parseFiles(t, filenames...)
+}
+
+// RenderFile parses the named file and renders it with data, writing the
+// output to w. It is a convenience for one-off renders; templates that are
+// rendered repeatedly should be parsed once.
+func RenderFile(filename string, data interface{}, w io.Writer) error {
+	t, err := ParseFile(filename)
+	if err != nil {
+		return err
+	}
+	return t.Render(w, data)
+}
@@ -0,0 +1,109 @@
+// Copyright 2014 Joel Scoble (github:mohae). All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package rollie
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+var pageData = map[string]string{"title": "Rollie", "body": "<text>"}
+
+const pageOutput = "<div><h1>Rollie</h1></div>\n<p>&lt;text&gt;</p>\n<div><footer>Rollie</footer></div>\n"
+
+func testRender(t *testing.T, tmpl *Template, data interface{}, want string) {
+	b := new(bytes.Buffer)
+	if err := tmpl.Render(b, data); err != nil {
+		t.Fatalf("render: %s", err)
+	}
+	if b.String() != want {
+		t.Errorf("expected\n\t%q\ngot\n\t%q", want, b.String())
+	}
+}
+
+func TestParseBytes(t *testing.T) {
+	tmpl, err := ParseBytes("bytes", []byte("<h1>{{title}}</h1>"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	testRender(t, tmpl, pageData, "<h1>Rollie</h1>")
+}
+
+func TestParseReader(t *testing.T) {
+	f, err := os.Open("testdata/header.mustache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	tmpl, err := ParseReader("header", iotest.OneByteReader(f))
+	if err != nil {
+		t.Fatal(err)
+	}
+	testRender(t, tmpl, pageData, "<h1>Rollie</h1>")
+	errRead := errors.New("read error")
+	if _, err := ParseReader("err", iotest.ErrReader(errRead)); err != errRead {
+		t.Errorf("expected %v, got %v", errRead, err)
+	}
+	if _, err := ParseReader("bad", strings.NewReader("{{#a}}")); err == nil {
+		t.Error("expected parse error; got none")
+	}
+}
+
+func TestParseFiles(t *testing.T) {
+	tmpl, err := ParseFiles("testdata/page.mustache", "testdata/header.mustache", "testdata/footer.mustache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tmpl.Name() != "page" {
+		t.Errorf("expected name %q, got %q", "page", tmpl.Name())
+	}
+	testRender(t, tmpl, pageData, pageOutput)
+}
+
+func TestParseFilesMethod(t *testing.T) {
+	tmpl := Must(New("root").Parse("[{{>header}}]"))
+	if _, err := tmpl.ParseFiles("testdata/header.mustache"); err != nil {
+		t.Fatal(err)
+	}
+	testRender(t, tmpl, pageData, "[<h1>Rollie</h1>]")
+}
+
+func TestParseFilesErrors(t *testing.T) {
+	if _, err := ParseFiles(); err == nil {
+		t.Error("expected error for no files; got none")
+	}
+	if _, err := ParseFile("testdata/nope.mustache"); err == nil {
+		t.Error("expected error for missing file; got none")
+	}
+}
+
+func TestParseGlob(t *testing.T) {
+	tmpl, err := ParseGlob("testdata/*.mustache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Glob matches are sorted, so footer is first.
+	if tmpl.Name() != "footer" {
+		t.Errorf("expected name %q, got %q", "footer", tmpl.Name())
+	}
+	testRender(t, tmpl.tmpl["page"], pageData, pageOutput)
+	if _, err := ParseGlob("testdata/*.nope"); err == nil {
+		t.Error("expected error for pattern matching no files; got none")
+	}
+}
+
+func TestRenderFile(t *testing.T) {
+	b := new(bytes.Buffer)
+	if err := RenderFile("testdata/header.mustache", pageData, b); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := b.String(), "<h1>Rollie</h1>"; got != want {
+		t.Errorf("expected %q, got %q", want, got)
+	}
+}
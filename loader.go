@@ -0,0 +1,111 @@
+// Copyright 2014 Joel Scoble (github:mohae). All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package rollie
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+)
+
+// PartialLoader loads the source of a partial, {{>name}}, that isn't one of
+// the template's associated templates. A loader must return an error for
+// which errors.Is(err, fs.ErrNotExist) is true when it has no partial with
+// the given name; any other error aborts the render.
+type PartialLoader interface {
+	Load(name string) (string, error)
+}
+
+// DefaultExtensions are the extensions tried, in order, by the directory
+// and fs.FS loaders when none are specified.
+var DefaultExtensions = []string{".mustache"}
+
+// MapLoader is a PartialLoader that holds the partials' source in memory,
+// keyed by name.
+type MapLoader map[string]string
+
+// Load returns the source of the named partial.
+func (m MapLoader) Load(name string) (string, error) {
+	src, ok := m[name]
+	if !ok {
+		return "", &fs.PathError{Op: "load", Path: name, Err: fs.ErrNotExist}
+	}
+	return src, nil
+}
+
+// FSLoader is a PartialLoader that reads partials from a file system, e.g.
+// an embed.FS. A partial's file is its name, which uses forward slashes for
+// subdirectories, with each of the extensions appended in turn until one
+// exists.
+type FSLoader struct {
+	FS         fs.FS
+	Extensions []string // Extensions to try, in order; "" uses the name as is.
+}
+
+// NewFSLoader returns a loader that reads partials from fsys. If no
+// extensions are passed, DefaultExtensions are used.
+func NewFSLoader(fsys fs.FS, extensions ...string) *FSLoader {
+	if len(extensions) == 0 {
+		extensions = DefaultExtensions
+	}
+	return &FSLoader{FS: fsys, Extensions: extensions}
+}
+
+// NewDirLoader returns a loader that reads partials from the files within
+// the directory dir. Partial names may not refer to files outside of dir.
+// If no extensions are passed, DefaultExtensions are used.
+func NewDirLoader(dir string, extensions ...string) *FSLoader {
+	return NewFSLoader(os.DirFS(dir), extensions...)
+}
+
+// Load returns the source of the named partial.
+func (l *FSLoader) Load(name string) (string, error) {
+	for _, ext := range l.Extensions {
+		b, err := fs.ReadFile(l.FS, name+ext)
+		if err == nil {
+			return string(b), nil
+		}
+		if !errors.Is(err, fs.ErrNotExist) {
+			return "", err
+		}
+	}
+	return "", &fs.PathError{Op: "load", Path: name, Err: fs.ErrNotExist}
+}
+
+// Loader sets the PartialLoader used to find partials that aren't
+// associated with t. Loaded partials are parsed with t's delimiters and are
+// then associated with t. The return value is the template, so calls can
+// be chained.
+func (t *Template) Loader(loader PartialLoader) *Template {
+	t.init()
+	t.loader = loader
+	return t
+}
+
+// partial returns the named partial: an associated template or, failing
+// that, one supplied by the loader. A nil template is returned if the
+// partial doesn't exist.
+func (t *Template) partial(name string) (*Template, error) {
+	t.muTmpl.RLock()
+	tmpl := t.tmpl[name]
+	loader := t.loader
+	t.muTmpl.RUnlock()
+	if tmpl != nil || loader == nil {
+		return tmpl, nil
+	}
+	src, err := loader.Load(name)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("rollie: loading partial %q: %w", name, err)
+	}
+	tmpl, err = t.New(name).Parse(src)
+	if err != nil {
+		return nil, err
+	}
+	return tmpl, nil
+}
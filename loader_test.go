@@ -0,0 +1,106 @@
+// Copyright 2014 Joel Scoble (github:mohae). All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package rollie
+
+import (
+	"bytes"
+	"errors"
+	"io/fs"
+	"testing"
+	"testing/fstest"
+
+	"github.com/mohae/rollie/parse"
+)
+
+func TestMapLoader(t *testing.T) {
+	tmpl := Must(New("map").Loader(MapLoader{"item": "<{{Name}}>"}).Parse("{{#Friends}}{{>item}}{{/Friends}}"))
+	testRender(t, tmpl, tVal, "<Ann><Bob>")
+	if _, err := (MapLoader{}).Load("nope"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("expected fs.ErrNotExist, got %v", err)
+	}
+}
+
+func TestFSLoader(t *testing.T) {
+	fsys := fstest.MapFS{
+		"item.mustache":          {Data: []byte("<{{Name}}>")},
+		"sub/detail.mustache":    {Data: []byte("{{Age}}")},
+		"plain":                  {Data: []byte("plain")},
+		"ext.html":               {Data: []byte("html")},
+		"shadowed.mustache.html": {Data: []byte("wrong")},
+	}
+	tmpl := Must(New("fs").Loader(NewFSLoader(fsys)).Parse("{{#Friends}}{{>item}}{{>sub/detail}}{{/Friends}}"))
+	testRender(t, tmpl, tVal, "<Ann>30<Bob>40")
+
+	tmpl = Must(New("exts").Loader(NewFSLoader(fsys, "", ".html")).Parse("{{>plain}} {{>ext}}"))
+	testRender(t, tmpl, nil, "plain html")
+}
+
+func TestDirLoader(t *testing.T) {
+	tmpl := Must(New("dir").Loader(NewDirLoader("testdata")).Parse("[{{>header}}]"))
+	testRender(t, tmpl, pageData, "[<h1>Rollie</h1>]")
+
+	// names may not escape the directory.
+	if _, err := NewDirLoader("testdata/spec").Load("../header"); err == nil {
+		t.Error("expected error loading partial outside of the directory; got none")
+	}
+}
+
+func TestAssociatedBeforeLoader(t *testing.T) {
+	tmpl := Must(New("assoc").Loader(MapLoader{"p": "loaded"}).Parse("{{>p}}"))
+	Must(tmpl.New("p").Parse("associated"))
+	testRender(t, tmpl, nil, "associated")
+}
+
+func TestMissingPartialOption(t *testing.T) {
+	tmpl := Must(New("missing").Loader(MapLoader{}).Parse("[{{>nope}}]"))
+	testRender(t, tmpl, nil, "[]")
+
+	tmpl.Option("missingpartial=error")
+	err := tmpl.Render(new(bytes.Buffer), nil)
+	if err == nil {
+		t.Fatal("expected error for missing partial; got none")
+	}
+	if _, ok := err.(RenderError); !ok {
+		t.Errorf("expected RenderError, got %T", err)
+	}
+}
+
+type errLoader struct{}
+
+func (errLoader) Load(string) (string, error) {
+	return "", errors.New("broken loader")
+}
+
+func TestLoaderError(t *testing.T) {
+	tmpl := Must(New("err").Loader(errLoader{}).Parse("{{>p}}"))
+	if err := tmpl.Render(new(bytes.Buffer), nil); err == nil {
+		t.Error("expected loader error; got none")
+	}
+}
+
+func TestLoadedParseError(t *testing.T) {
+	tmpl := Must(New("page").Loader(MapLoader{"p": "a\n{{#b}}"}).Parse("{{>p}}"))
+	err := tmpl.Render(new(bytes.Buffer), nil)
+	var perr *parse.Error
+	if !errors.As(err, &perr) {
+		t.Fatalf("expected *parse.Error, got %T: %v", err, err)
+	}
+	if perr.Name != "p" || perr.Line != 2 {
+		t.Errorf("expected error at p:2, got %s:%d", perr.Name, perr.Line)
+	}
+}
+
+func TestOptionPanics(t *testing.T) {
+	for _, opt := range []string{"", "missingpartial", "missingpartial=nope", "nope=error", "escape=nope"} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("%q: expected panic; got none", opt)
+				}
+			}()
+			New("opt").Option(opt)
+		}()
+	}
+}
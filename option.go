@@ -0,0 +1,135 @@
+// Copyright 2014 Joel Scoble (github:mohae). All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+//
+// This code is based on code originally written by The Go Authors.
+// Their copyright notice immediately follows this one.
+
+// Copyright 2015 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// This file contains the code to handle template options.
+
+package rollie
+
+import "strings"
+
+// missingPartialAction defines how to respond to a partial that can't be
+// found.
+type missingPartialAction int
+
+const (
+	mpEmpty missingPartialAction = iota // Render nothing, as the spec requires.
+	mpError                             // Error out.
+)
+
+// missingKeyAction defines how to respond to a variable or section whose
+// name can't be found.
+type missingKeyAction int
+
+const (
+	mkIgnore missingKeyAction = iota // Render nothing, as the spec requires.
+	mkError                          // Error out.
+	mkZero                           // Use the zero value of the map's elements.
+)
+
+type option struct {
+	missingPartial missingPartialAction
+	missingKey     missingKeyAction
+	escaper        Escaper // nil is HTMLEscaper
+}
+
+// Option sets options for the template. Options are described by
+// strings, either a simple string or "key=value". There can be at
+// most one equals sign in an option string. If the option string
+// is unrecognized or otherwise invalid, Option panics.
+//
+// Known options:
+//
+// missingpartial: Control the behavior during rendering if a partial
+// can be neither found among the associated templates nor loaded.
+//
+//	"missingpartial=default" or "missingpartial=empty"
+//		The default behavior: Render nothing, as the Mustache spec
+//		requires.
+//	"missingpartial=error"
+//		Rendering stops immediately with an error.
+//
+// missingkey: Control the behavior during rendering if the name of a
+// variable or section, but not of an inverted section, can't be found in
+// the context stack.
+//
+//	"missingkey=default" or "missingkey=ignore"
+//		The default behavior: Render nothing, as the Mustache spec
+//		requires.
+//	"missingkey=error"
+//		Rendering stops immediately with a *MissingKeyError.
+//	"missingkey=zero"
+//		If the name was looked for in a map, the zero value of the
+//		map's elements is rendered, e.g. 0 for a map[string]int;
+//		otherwise nothing is.
+//
+// escape: Set the escaper of the values of escaped tags for the templates
+// that don't have their own, see Template.Escaper.
+//
+//	"escape=html" or "escape=default"
+//		The default behavior: HTMLEscaper, as the Mustache spec
+//		requires.
+//	"escape=htmlapos"
+//		HTMLAposEscaper.
+//	"escape=xml", "escape=json", "escape=url"
+//		XMLEscaper, JSONEscaper or URLEscaper.
+//	"escape=none"
+//		NoEscaper: values are written as is.
+//	"escape=contextual"
+//		ContextualEscaper: values are escaped for their context within
+//		HTML.
+func (t *Template) Option(opt ...string) *Template {
+	t.init()
+	for _, s := range opt {
+		t.setOption(s)
+	}
+	return t
+}
+
+func (t *Template) setOption(opt string) {
+	if opt == "" {
+		panic("empty option string")
+	}
+	// key=value
+	if key, value, ok := strings.Cut(opt, "="); ok {
+		switch key {
+		case "missingpartial":
+			switch value {
+			case "empty", "default":
+				t.option.missingPartial = mpEmpty
+				return
+			case "error":
+				t.option.missingPartial = mpError
+				return
+			}
+		case "missingkey":
+			switch value {
+			case "ignore", "default":
+				t.option.missingKey = mkIgnore
+				return
+			case "error":
+				t.option.missingKey = mkError
+				return
+			case "zero":
+				t.option.missingKey = mkZero
+				return
+			}
+		case "escape":
+			if value == "default" {
+				value = "html"
+			}
+			if e, ok := escapers[value]; ok {
+				t.option.escaper = e
+				return
+			}
+		}
+	}
+	panic("unrecognized option: " + opt)
+}
@@ -50,6 +50,7 @@ const (
 	itemCR         // \r
 	itemIdentifier //
 	itemDiscard    // stuff that gets discarded
+	itemIndent     // indentation of a standalone partial; made by the parser
 
 	itemOTag // {{
 	itemCTag // }}
@@ -65,15 +66,17 @@ const (
 	tagComment    //! : {{!comment}}
 	tagPartial    // > : {{>partial
 	tagΔDelimiter // = : {{=| |=}} : | is the new oTag and cTag
+	tagParent     // < : {{<parent}}
+	tagBlock      // $ : {{$block}}
 
 	identEscaped
 	identUnescaped
 
 	markerDot   // . : {{.}}
 	markerIndex // -index : {{-index}}
-	markerFirst // #-first : {{#-first}} {{/first}}
-	markerLast  // /-last : {{#-first}} {{/first}}
-	markerOdd   // #-odd : {{#-odd}} {{/-odd}}
+	markerFirst // -first : {{#-first}} {{/-first}}
+	markerLast  // -last : {{#-last}} {{/-last}}
+	markerOdd   // -odd : {{#-odd}} {{/-odd}}
 	markerText  // " : {{"sometext}}
 
 	//residual stuff should be replaced with correct itemType from above
@@ -107,6 +110,7 @@ var ItemStrings = [...]string{
 	//	itemNil:            "nil",
 	itemIdentifier: "identifier",
 	itemDiscard:    "discard",
+	itemIndent:     "indent",
 	itemOTag:       "otag",
 	itemCTag:       "ctag",
 	tagEscaped:     "escapedVarTag",
@@ -118,6 +122,8 @@ var ItemStrings = [...]string{
 	tagComment:     "commentTag",
 	tagPartial:     "partialTag",
 	tagΔDelimiter:  "ΔDelimiterTag",
+	tagParent:      "parentTag",
+	tagBlock:       "blockTag",
 	identEscaped:   "escapedVar",
 	identUnescaped: "unescapedVar",
 	markerDot:      "markerDot",
@@ -144,21 +150,27 @@ type lexer struct {
 	cTag string // close tag info
 	cLen int
 
-	state       stateFn   // the next lexing function to enter
-	pos         Pos       // current position in the input
-	start       Pos       // start position of this item
-	width       Pos       // width of last rune read from input
-	lastPos     Pos       // position of most recent item returned by nextItem
-	items       chan item // channel of scanned items
-	parentDepth int       // nesting depth of ( ) exprs
+	state       stateFn // the next lexing function to enter
+	pos         Pos     // current position in the input
+	start       Pos     // start position of this item
+	width       Pos     // width of last rune read from input
+	items       []item  // scanned items not yet returned by nextItem
+	buf         [2]item // backing store for items, to avoid allocation
+	parentDepth int     // nesting depth of ( ) exprs
 }
 
 // Returns a new, initialized lexer with the tag defaults set to {{}}.
 func NewLexerFromString(name, data string, initState stateFn) *lexer {
-	l := &lexer{name: name, input: data, oTag: OTag, oLen: OLen, cTag: CTag, cLen: CLen, state: initState, items: make(chan item, 2)}
+	l := &lexer{name: name, input: data, oTag: OTag, oLen: OLen, cTag: CTag, cLen: CLen, state: initState}
 	return l
 }
 
+// Returns a new, initialized lexer, over data, with the tag defaults set to
+// {{}}. data is not copied and must not be modified while it is lexed.
+func NewLexerFromBytes(name string, data []byte, initState stateFn) *lexer {
+	return NewLexerFromString(name, bytesToString(data), initState)
+}
+
 // next returns the next rune in input.
 func (l *lexer) next() rune {
 	if int(l.pos) >= len(l.input) {
@@ -199,9 +211,17 @@ func (l *lexer) backup() {
 	l.pos -= l.width
 }
 
+// push queues an item to be returned by nextItem.
+func (l *lexer) push(it item) {
+	if len(l.items) == 0 {
+		l.items = l.buf[:0]
+	}
+	l.items = append(l.items, it)
+}
+
 // emit the current item information
 func (l *lexer) emit(t itemType) {
-	l.items <- item{typ: t, pos: l.start, value: l.input[l.start:l.pos]}
+	l.push(item{typ: t, pos: l.start, value: l.input[l.start:l.pos]})
 	l.start = l.pos
 }
 
@@ -217,24 +237,25 @@ func (l *lexer) ignorePrior() {
 	l.next()
 }
 
-// lineNumber reports which line we're on, based on the position of
-// the previous item returned by nextItem. Doing it this way
-// means we don't have to worry about peek double counting.
-func (l *lexer) lineNumber() int {
-	return 1 + strings.Count(l.input[:l.lastPos], "\n")
-}
-
-// error returns an error token and terminates the scan by passing back
-// a nil pointer that will be the next state, terminating l.run.
+// errorf queues an error item and terminates the scan by returning a nil
+// state; nextItem returns EOF from then on.
 func (l *lexer) errorf(format string, args ...interface{}) stateFn {
-	l.items <- item{typ: ERROR, value: fmt.Sprintf(format, args...), pos: l.start}
+	l.push(item{typ: ERROR, value: fmt.Sprintf(format, args...), pos: l.start})
 	return nil
 }
 
-// nextItem returns the next item from the input.
+// nextItem returns the next item from the input. The lexer's state
+// functions are run, on demand, until one emits an item. Once the input has
+// been consumed, or an error found, an EOF item is returned.
 func (l *lexer) nextItem() item {
-	item := <-l.items
-	l.lastPos = item.pos
+	for len(l.items) == 0 {
+		if l.state == nil {
+			return item{typ: EOF, pos: l.pos}
+		}
+		l.state = l.state(l)
+	}
+	item := l.items[0]
+	l.items = l.items[1:]
 	return item
 }
 
@@ -246,35 +267,22 @@ func lex(name, input, oTag, cTag string) *lexer {
 	if cTag == "" {
 		cTag = CTag
 	}
-	l := &lexer{
+	return &lexer{
 		name:  name,
 		oTag:  oTag,
 		oLen:  len(oTag),
 		cTag:  cTag,
 		cLen:  len(cTag),
 		input: input,
-		items: make(chan item, 2), // Two item ring buffer
-	}
-	go l.run()
-	return l
-}
-
-// run runs the state machine for the lexer.
-func (l *lexer) run() {
-	for l.state = lexText; l.state != nil; {
-		l.state = l.state(l)
+		state: lexText,
 	}
 }
 
 // state functions
 
-// Change approach to maintain a stack of recent history.
-// Stack will only be used when new lines and groups of spaces
-// are encountered.
-// When a non stack-adding item is encountered, the stack will
-// be reset, unless the next items accumulate into a comment.
-// At which point the stack will be evaluated.
-// Stacks are reset at the end of each comment.
+// Spaces and newlines are emitted as their own items so that the parser,
+// which reads a line of items at a time, can remove the whitespace around
+// standalone tags.
 
 // lexText checks for the basic block types and has them handled.
 func lexText(l *lexer) stateFn {
@@ -305,14 +313,6 @@ func lexText(l *lexer) stateFn {
 			}
 			return lexSpace(l)
 		}
-		/* TODO proper dot handling
-		if c == '.' {
-			if l.pos > l.start {
-				l.emit(itemText)
-			}
-			return lexDot(l)
-		}
-		*/
 		if l.next() == eof {
 			break
 		}
@@ -322,7 +322,7 @@ func lexText(l *lexer) stateFn {
 		l.emit(itemText)
 	}
 	l.emit(EOF)
-	return nil // Stop the run loop.
+	return nil // No more states; nextItem returns EOF.
 }
 
 // lexOTag checks to see what kind of tag this is, with an undecorated tag
@@ -336,7 +336,10 @@ func lexOTag(l *lexer) stateFn {
 		// comments get elided so we don't emit anything
 		l.emit(tagComment)
 		return lexComment
-	case '{', '&': // unescaped comment
+	case '{': // unescaped, closed by an extra }
+		l.emit(tagUnescaped)
+		return lexTriple
+	case '&': // unescaped
 		l.emit(tagUnescaped)
 		return lexUnescaped
 	case '#': // section
@@ -354,6 +357,15 @@ func lexOTag(l *lexer) stateFn {
 	case '=': // delimiter change
 		l.emit(tagΔDelimiter)
 		return lexΔDelimiter
+	case '"': // literal text
+		l.emit(markerText)
+		return lexLiteral
+	case '<': // parent
+		l.emit(tagParent)
+		return lexSection
+	case '$': // block
+		l.emit(tagBlock)
+		return lexSection
 	}
 
 	// default is escaped varialble: {{variable}}
@@ -399,91 +411,117 @@ func lexEscaped(l *lexer) stateFn {
 	case i == 0:
 		return lexCTag
 	}
+	if isDot(l.input[l.pos : l.pos+Pos(i)]) {
+		return lexDot
+	}
 	l.pos += Pos(i)
-	l.emit(identEscaped)
+	if strings.TrimSpace(l.input[l.start:l.pos]) == "-index" {
+		l.emit(markerIndex)
+	} else {
+		l.emit(identEscaped)
+	}
 	return lexCTag
 }
 
-// lexUnescaped handles unescaped variable lexing. This only creates a token,
-// item, of the variable.
+// lexUnescaped handles unescaped variable lexing, of an & tag. This only
+// creates a token, item, of the variable.
 func lexUnescaped(l *lexer) stateFn {
-	i := strings.Index(l.input[l.pos:], l.cTag)
-	switch true {
-	case i < 0:
-		return l.errorf("unclosed escaped variable tag")
-	case i == 0:
-		return lexCTag
+	return l.unescaped(l.cTag)
+}
+
+// lexTriple handles triple mustache lexing, {{{name}}}. The tag must be
+// closed by a } followed by the close delimiter; the } is elided.
+func lexTriple(l *lexer) stateFn {
+	return l.unescaped("}" + l.cTag)
+}
+
+// unescaped lexes the name of an unescaped variable tag that is closed by
+// close, and elides what precedes the close delimiter in close.
+func (l *lexer) unescaped(close string) stateFn {
+	i := strings.Index(l.input[l.pos:], close)
+	if i < 0 {
+		if close != l.cTag {
+			return l.errorf("unclosed unescaped variable tag: expected %q", close)
+		}
+		return l.errorf("unclosed unescaped variable tag")
 	}
-	l.pos += Pos(i)
-	l.emit(identUnescaped)
-	// see if there is a }}}, elide the first if there is
-	if strings.HasPrefix(l.input[l.pos:], "}"+l.cTag) {
-		l.pos += Pos(1)
-		l.start = l.pos
+	if i > 0 {
+		l.pos += Pos(i)
+		switch name := l.input[l.start:l.pos]; {
+		case isDot(name):
+			l.emit(markerDot)
+		case strings.TrimSpace(name) == "-index":
+			l.emit(markerIndex)
+		default:
+			l.emit(identUnescaped)
+		}
 	}
+	l.pos += Pos(len(close) - len(l.cTag))
+	l.start = l.pos
 	return lexCTag
 }
 
-// lexΔDelimiter handles the update of current oTag and cTag info
-// with the new delimiter, e.g. {{=| |=}} {{=%% %%=}} {{= | | =}}
-// TODO clean this up with some sane code
+// lexΔDelimiter scans a set delimiter tag, e.g. {{=<% %>=}} or
+// {{= | | =}}, and switches the lexer to the new delimiters. The = has
+// already been consumed. The new open and close delimiters are separated by
+// whitespace and may not contain whitespace or '='.
 func lexΔDelimiter(l *lexer) stateFn {
-	// cache cTag info because it will be replace during the course of execution
-	origCTagPos := strings.Index(l.input[l.pos:], l.cTag)
-	if origCTagPos < 0 {
-		return l.errorf("rollie: unclosed delimiter tag")
-	}
-	origCTagPos += int(l.pos)
-	cLenOrig := l.cLen
-	// skip any spaces between = and Otag
-	pos := skipWhitespace(l)
-	if pos < 0 {
-		return l.errorf("rollie: unexpected EOF encountered while changing delimiters")
+	i := strings.Index(l.input[l.pos:], "="+l.cTag)
+	if i < 0 {
+		return l.errorf("unclosed set delimiter tag")
 	}
-	endPos := nextWhitespace(l)
-	if endPos < 0 {
-		return l.errorf("rollie: unable to find end of new delimiter, check that there is a space following it")
+	delims := strings.Fields(l.input[l.pos : l.pos+Pos(i)])
+	if len(delims) != 2 {
+		return l.errorf("set delimiter tag must hold two delimiters separated by whitespace: %q", l.input[l.pos:l.pos+Pos(i)])
 	}
-	// Extract the new otag
-	l.oTag = strings.TrimSpace(l.input[pos:endPos])
-	l.oLen = len(l.oTag)
-	l.start = Pos(endPos)
-	l.pos = Pos(endPos)
-
-	//	nxt := l.next() // skip the =
-	// skip the whitespace that separates delims
-	_ = skipWhitespace(l)
-	l.cTag = ""
-	// get everything before the end delim
-	for l.peek() != '=' {
-		r := l.next()
-		if r == ' ' {
-			continue
+	for _, delim := range delims {
+		if strings.Contains(delim, "=") {
+			return l.errorf("delimiter %q may not contain '='", delim)
 		}
-
-		l.cTag += string(r)
 	}
-	l.cLen = len(l.cTag)
-	skipWhitespace(l)
-	// check for the second = sign since it should be there.
-	if l.peek() != '=' {
-		return l.errorf("rollie: expected '=' got %q while trying to close a change delimiter tag", l.peek())
-	}
-	// skip to the original cTag
-	l.start = Pos(origCTagPos)
-	l.pos = Pos(origCTagPos + cLenOrig)
+	// The tag is closed by the delimiter it was opened with.
+	l.pos += Pos(i + 1)
+	l.ignore()
+	l.pos += Pos(l.cLen)
 	l.emit(itemCTag)
+	l.oTag, l.cTag = delims[0], delims[1]
+	l.oLen, l.cLen = len(l.oTag), len(l.cTag)
 	return lexText
 }
 
-// lexSection processes a section {{#section}} stuff {{\section}}
+// lexLiteral scans the contents of a literal text tag, {{"text}}, which
+// end at the first closing delimiter. The contents may hold anything else,
+// including open delimiters and quotes.
+func lexLiteral(l *lexer) stateFn {
+	i := strings.Index(l.input[l.pos:], l.cTag)
+	if i < 0 {
+		return l.errorf("unclosed literal text tag")
+	}
+	if i > 0 {
+		l.pos += Pos(i)
+		l.emit(itemText)
+	}
+	return lexCTag
+}
+
+// lexSection processes a section {{#section}} stuff {{\section}}. The
+// iteration markers, e.g. {{#-first}}, are emitted as such.
 func lexSection(l *lexer) stateFn {
 	i := strings.Index(l.input[l.pos:], l.cTag)
 	if i < 0 {
 		return l.errorf("unclosed tag")
 	}
 	l.pos += Pos(i)
-	l.emit(itemIdentifier)
+	switch strings.TrimSpace(l.input[l.start:l.pos]) {
+	case "-first":
+		l.emit(markerFirst)
+	case "-last":
+		l.emit(markerLast)
+	case "-odd":
+		l.emit(markerOdd)
+	default:
+		l.emit(itemIdentifier)
+	}
 	return lexCTag
 }
 
@@ -517,11 +555,12 @@ func lexCR(l *lexer) stateFn {
 	return lexText
 }
 
-// lexDot: .
+// lexDot scans the implicit iterator, the . in {{.}}, along with any
+// whitespace around it.
 func lexDot(l *lexer) stateFn {
-	l.next()
+	l.pos += Pos(strings.Index(l.input[l.pos:], l.cTag))
 	l.emit(markerDot)
-	return lexText
+	return lexCTag
 }
 
 // lexNL, aka LF: \n
@@ -531,37 +570,10 @@ func lexNL(l *lexer) stateFn {
 	return lexText
 }
 
-func nextWhitespace(l *lexer) int {
-	pos := l.pos
-	var r rune
-	for {
-		r = l.next()
-		if isSpace(r) {
-			// set pointer to its original pos
-			ret := int(l.pos)
-			l.pos = pos
-			return ret
-		}
-
-	}
-	// if we got here, no space was found
-	return -1
-}
-
-// skips whitespace
-func skipWhitespace(l *lexer) int {
-	var r rune
-	for {
-		r = l.peek()
-		if isSpace(r) {
-			l.next()
-			continue
-		}
-		l.ignore()
-		return int(l.pos)
-	}
-	// shouldn't get here
-	return -1
+// isDot reports whether the contents of a variable tag are the implicit
+// iterator, '.'.
+func isDot(s string) bool {
+	return strings.TrimSpace(s) == "."
 }
 
 // isSpace reports whether r is a space character.
@@ -11,7 +11,10 @@
 
 package parse
 
-import "testing"
+import (
+	"strings"
+	"testing"
+)
 
 // collect gathers the emitted items into a slice.-- for development
 func collect(t *lexTest, left, right string) (items []item) {
@@ -125,6 +128,30 @@ var lexTests = []lexTest{
 		{itemCTag, 24, "}}"},
 		{EOF, 26, ""},
 	}},
+	{"tag ΔDelimiter spacing", "{{=  <%\t%>  =}}<%a%>", []item{
+		{tagΔDelimiter, 0, "{{="},
+		{itemCTag, 13, "}}"},
+		{tagEscaped, 15, "<%"},
+		{identEscaped, 17, "a"},
+		{itemCTag, 18, "%>"},
+		{EOF, 20, ""},
+	}},
+	{"tag ΔDelimiter no space", "{{=<%%>=}}", []item{
+		{tagΔDelimiter, 0, "{{="},
+		{ERROR, 3, `set delimiter tag must hold two delimiters separated by whitespace: "<%%>"`},
+	}},
+	{"tag ΔDelimiter unclosed", "{{=< >", []item{
+		{tagΔDelimiter, 0, "{{="},
+		{ERROR, 3, "unclosed set delimiter tag"},
+	}},
+	{"tag ΔDelimiter equals", "{{=<= =>=}}", []item{
+		{tagΔDelimiter, 0, "{{="},
+		{ERROR, 3, `delimiter "<=" may not contain '='`},
+	}},
+	{"tag ΔDelimiter three", "{{=< % >=}}", []item{
+		{tagΔDelimiter, 0, "{{="},
+		{ERROR, 3, `set delimiter tag must hold two delimiters separated by whitespace: "< % >"`},
+	}},
 }
 
 func equal(i1, i2 []item, checkPos bool) bool {
@@ -235,3 +262,31 @@ func TestSimpleStache(t *testing.T) {
 		}
 	}
 }
+
+// benchTemplate is a large template that exercises most of the lexer.
+var benchTemplate = strings.Repeat(`<h1>{{title}}</h1>
+{{! a comment }}
+<ul>
+  {{#items}}
+  <li class="{{#-odd}}odd{{/-odd}}">{{-index}}: {{name}} &amp; {{{html}}}</li>
+  {{/items}}
+  {{^items}}
+  <li>none</li>
+  {{/items}}
+</ul>
+  {{>footer}}
+`, 1000)
+
+func BenchmarkLex(b *testing.B) {
+	b.SetBytes(int64(len(benchTemplate)))
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		l := lex("bench", benchTemplate, "", "")
+		for {
+			it := l.nextItem()
+			if it.typ == EOF || it.typ == ERROR {
+				break
+			}
+		}
+	}
+}
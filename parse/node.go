@@ -63,6 +63,7 @@ const (
 	NodeInverted
 	NodePartial
 	NodeParent
+	NodeBlock
 	NodeList     // A list of nodes
 	NodePipe     // A pipeline of commands.
 	NodeTemplate // A template invocation action.
@@ -110,6 +111,8 @@ func (n NodeType) String() string {
 		return "NodePartial"
 	case NodeParent:
 		return "NodeParent"
+	case NodeBlock:
+		return "NodeBlock"
 	case NodeList:
 		return "NodeList"
 	case NodePipe:
@@ -159,8 +162,8 @@ type TextNode struct {
 	Text []byte // The text; may span newlines.
 }
 
-func newText(pos Pos, text string) *TextNode {
-	return &TextNode{NodeType: NodeText, Pos: pos, Text: []byte(text)}
+func newText(pos Pos, text []byte) *TextNode {
+	return &TextNode{NodeType: NodeText, Pos: pos, Text: text}
 }
 
 func (t *TextNode) String() string {
@@ -178,8 +181,8 @@ type NLNode struct {
 	Text []byte
 }
 
-func newNL(pos Pos, text string) *NLNode {
-	return &NLNode{NodeType: NodeNL, Pos: pos, Text: []byte(text)}
+func newNL(pos Pos, text []byte) *NLNode {
+	return &NLNode{NodeType: NodeNL, Pos: pos, Text: text}
 }
 
 func (nl *NLNode) String() string {
@@ -197,8 +200,8 @@ type CRNode struct {
 	Text []byte
 }
 
-func newCR(pos Pos, text string) *CRNode {
-	return &CRNode{NodeType: NodeCR, Pos: pos, Text: []byte(text)}
+func newCR(pos Pos, text []byte) *CRNode {
+	return &CRNode{NodeType: NodeCR, Pos: pos, Text: text}
 }
 
 func (cr *CRNode) String() string {
@@ -216,8 +219,8 @@ type SpaceNode struct {
 	Text []byte
 }
 
-func newSpace(pos Pos, text string) *SpaceNode {
-	return &SpaceNode{NodeType: NodeSpace, Pos: pos, Text: []byte(text)}
+func newSpace(pos Pos, text []byte) *SpaceNode {
+	return &SpaceNode{NodeType: NodeSpace, Pos: pos, Text: text}
 }
 
 func (t *SpaceNode) String() string {
@@ -247,26 +250,24 @@ func (t *CTagNode) Copy() Node {
 	return &CTagNode{NodeType: NodeCTag, Text: append([]byte{}, t.Text...)}
 }
 
-// CommentNode holds a tag
+// CommentNode holds a comment, {{!comment}}. Comments are never rendered.
 type CommentNode struct {
 	NodeType
-	TagType itemType
 	Pos
-	//	Width int
 	Line int
-	Pipe *PipeNode
+	Text []byte // The comment's text; may span newlines.
 }
 
-func newComment(pos Pos, line int, pipe *PipeNode) *CommentNode {
-	return &CommentNode{NodeType: NodeComment, Pos: pos, Line: line, Pipe: pipe}
+func newComment(pos Pos, line int, text string) *CommentNode {
+	return &CommentNode{NodeType: NodeComment, Pos: pos, Line: line, Text: []byte(text)}
 }
 
 func (t *CommentNode) String() string {
-	return fmt.Sprintf("{{%s}}", t.Pipe)
+	return fmt.Sprintf("{{!%s}}", t.Text)
 }
 
 func (t *CommentNode) Copy() Node {
-	return &CommentNode{NodeType: t.NodeType, TagType: t.TagType, Pos: t.Pos, Line: t.Line, Pipe: t.Pipe.CopyPipe()}
+	return &CommentNode{NodeType: t.NodeType, Pos: t.Pos, Line: t.Line, Text: append([]byte{}, t.Text...)}
 }
 
 // VariableNode holds an escaped variable
@@ -274,87 +275,141 @@ type VariableNode struct {
 	NodeType
 	Typ itemType // Variables can be escaped or unescaped; this is for that.
 	Pos
+	Line  int
 	Ident []string // Variable name and fields in lexical order
 }
 
-func newVariable(typ itemType, pos Pos, ident string) *VariableNode {
-	return &VariableNode{NodeType: NodeVariable, Typ: typ, Pos: pos, Ident: strings.Split(ident, ".")}
+func newVariable(typ itemType, pos Pos, line int, ident string) *VariableNode {
+	return &VariableNode{NodeType: NodeVariable, Typ: typ, Pos: pos, Line: line, Ident: strings.Split(ident, ".")}
+}
+
+// Escaped reports whether the variable's value is to be escaped when it
+// is rendered: {{name}} is escaped, {{{name}}} and {{&name}} are not.
+func (v *VariableNode) Escaped() bool {
+	return v.Typ != identUnescaped
 }
 
 func (v *VariableNode) String() string {
-	s := ""
-	for i, id := range v.Ident {
-		if i > 0 {
-			s += "."
-		}
-		s += id
+	if v.Typ == identUnescaped {
+		return fmt.Sprintf("{{{%s}}}", strings.Join(v.Ident, "."))
 	}
-	return s
+	return fmt.Sprintf("{{%s}}", strings.Join(v.Ident, "."))
 }
 
 func (v *VariableNode) Copy() Node {
-	return &VariableNode{NodeType: NodeVariable, Typ: v.Typ, Pos: v.Pos, Ident: append([]string{}, v.Ident...)}
+	return &VariableNode{NodeType: NodeVariable, Typ: v.Typ, Pos: v.Pos, Line: v.Line, Ident: append([]string{}, v.Ident...)}
 }
 
-// DotNode holds the special identifier '.'.
+// DotNode holds the implicit iterator, {{.}}, which is the top of the
+// context stack.
 type DotNode struct {
+	NodeType
+	Typ itemType // Like variables, dots can be escaped or unescaped.
 	Pos
+	Line int
 }
 
-func newDot(pos Pos) *DotNode {
-	return &DotNode{Pos: pos}
+func newDot(typ itemType, pos Pos, line int) *DotNode {
+	return &DotNode{NodeType: NodeDot, Typ: typ, Pos: pos, Line: line}
 }
 
-func (d *DotNode) Type() NodeType {
-	return NodeDot
+// Escaped reports whether the value is to be escaped when it is rendered:
+// {{.}} is escaped, {{{.}}} and {{&.}} are not.
+func (d *DotNode) Escaped() bool {
+	return d.Typ != identUnescaped
 }
 
 func (d *DotNode) String() string {
-	return "."
+	if d.Typ == identUnescaped {
+		return "{{{.}}}"
+	}
+	return "{{.}}"
 }
 
 func (d *DotNode) Copy() Node {
-	return newDot(d.Pos)
+	return newDot(d.Typ, d.Pos, d.Line)
 }
 
-// InvertedNode holds an identifier.
+// splitIdent splits a section name into its fields. The implicit iterator,
+// ".", is kept whole.
+func splitIdent(ident string) []string {
+	if ident == "." {
+		return []string{"."}
+	}
+	return strings.Split(ident, ".")
+}
+
+// SectionNode holds a section, {{#name}}...{{/name}}, and the list of nodes
+// within it.
+type SectionNode struct {
+	NodeType
+	Pos
+	Line       int
+	Ident      []string  // Section name and fields in lexical order.
+	List       *ListNode // The contents of the section.
+	Text       string    // The unrendered source of the contents, for lambdas.
+	LeftDelim  string    // The delimiters in effect at the section tag.
+	RightDelim string
+}
+
+func newSection(pos Pos, line int, ident string, list *ListNode) *SectionNode {
+	return &SectionNode{NodeType: NodeSection, Pos: pos, Line: line, Ident: splitIdent(ident), List: list}
+}
+
+// Name returns the section's name as it appears in the template.
+func (s *SectionNode) Name() string {
+	return strings.Join(s.Ident, ".")
+}
+
+func (s *SectionNode) String() string {
+	return fmt.Sprintf("{{#%s}}%s{{/%s}}", s.Name(), s.List, s.Name())
+}
+
+func (s *SectionNode) Copy() Node {
+	return &SectionNode{NodeType: NodeSection, Pos: s.Pos, Line: s.Line, Ident: append([]string{}, s.Ident...), List: s.List.CopyList(),
+		Text: s.Text, LeftDelim: s.LeftDelim, RightDelim: s.RightDelim}
+}
+
+// InvertedNode holds an inverted section, {{^name}}...{{/name}}, and the
+// list of nodes within it.
 type InvertedNode struct {
 	NodeType
 	Pos
-	Ident string // The identifier's name.
+	Line  int
+	Ident []string  // Section name and fields in lexical order.
+	List  *ListNode // The contents of the section.
 }
 
-// NewInverted returns a new InvertedNode with the given identifier name.
-func newInverted(ident string) *InvertedNode {
-	return &InvertedNode{NodeType: NodeInverted, Ident: ident}
+func newInverted(pos Pos, line int, ident string, list *ListNode) *InvertedNode {
+	return &InvertedNode{NodeType: NodeInverted, Pos: pos, Line: line, Ident: splitIdent(ident), List: list}
 }
 
-// SetPos sets the position. ParentNode is a public method so we can't modify its signature.
-// Chained for convenience.
-// TODO: fix one day?
-func (i *InvertedNode) SetPos(pos Pos) *InvertedNode {
-	i.Pos = pos
-	return i
+// Name returns the section's name as it appears in the template.
+func (i *InvertedNode) Name() string {
+	return strings.Join(i.Ident, ".")
 }
 
 func (i *InvertedNode) String() string {
-	return i.Ident
+	return fmt.Sprintf("{{^%s}}%s{{/%s}}", i.Name(), i.List, i.Name())
 }
 
 func (i *InvertedNode) Copy() Node {
-	return newInverted(i.Ident).SetPos(i.Pos)
+	return &InvertedNode{NodeType: NodeInverted, Pos: i.Pos, Line: i.Line, Ident: append([]string{}, i.Ident...), List: i.List.CopyList()}
 }
 
 // PartialNode holds an identifier.
 type PartialNode struct {
 	NodeType
 	Pos
-	Ident string // The identifier's name.
+	Line       int
+	Ident      string // The identifier's name.
+	Standalone bool   // Whether the tag is alone on its line.
+	Indent     string // The whitespace preceding a standalone tag.
 }
 
 // NewPartial returns a new PartialNode with the given identifier name.
-func newPartial(pos Pos, ident string) *PartialNode {
-	return &PartialNode{NodeType: NodePartial, Pos: pos, Ident: ident}
+func newPartial(pos Pos, line int, ident string) *PartialNode {
+	return &PartialNode{NodeType: NodePartial, Pos: pos, Line: line, Ident: ident}
 }
 
 // SetPos sets the position. NewIdentifier is a public method so we can't modify its signature.
@@ -366,39 +421,74 @@ func (i *PartialNode) SetPos(pos Pos) *PartialNode {
 }
 
 func (i *PartialNode) String() string {
-	return i.Ident
+	return fmt.Sprintf("{{>%s}}", i.Ident)
 }
 
 func (i *PartialNode) Copy() Node {
-	return newPartial(i.Pos, i.Ident)
+	p := newPartial(i.Pos, i.Line, i.Ident)
+	p.Standalone = i.Standalone
+	p.Indent = i.Indent
+	return p
 }
 
-// ParentNode holds an identifier.
+// ParentNode holds a parent, {{<name}}...{{/name}}: the named template
+// rendered with the blocks within the parent tag overriding its own.
 type ParentNode struct {
 	NodeType
 	Pos
-	Ident string // The identifier's name.
+	Line       int
+	Ident      string    // The name of the parent template.
+	List       *ListNode // The contents of the parent tag; only blocks are used.
+	Standalone bool      // Whether the tags are on a line of their own.
+	Indent     string    // Indentation of a standalone parent.
 }
 
-// NewParent returns a new ParentNode with the given identifier name.
-func newParent(ident string) *ParentNode {
-	return &ParentNode{NodeType: NodeParent, Ident: ident}
+func newParent(pos Pos, line int, ident string, list *ListNode) *ParentNode {
+	return &ParentNode{NodeType: NodeParent, Pos: pos, Line: line, Ident: ident, List: list}
 }
 
-// SetPos sets the position. ParentNode is a public method so we can't modify its signature.
-// Chained for convenience.
-// TODO: fix one day?
-func (i *ParentNode) SetPos(pos Pos) *ParentNode {
-	i.Pos = pos
-	return i
+// Blocks returns the blocks, the overrides, within the parent tag.
+func (p *ParentNode) Blocks() []*BlockNode {
+	var blocks []*BlockNode
+	for _, n := range p.List.Nodes {
+		if b, ok := n.(*BlockNode); ok {
+			blocks = append(blocks, b)
+		}
+	}
+	return blocks
 }
 
-func (i *ParentNode) String() string {
-	return i.Ident
+func (p *ParentNode) String() string {
+	return fmt.Sprintf("{{<%s}}%s{{/%s}}", p.Ident, p.List, p.Ident)
+}
+
+func (p *ParentNode) Copy() Node {
+	n := newParent(p.Pos, p.Line, p.Ident, p.List.CopyList())
+	n.Standalone = p.Standalone
+	n.Indent = p.Indent
+	return n
+}
+
+// BlockNode holds a block, {{$name}}...{{/name}}: content that a template
+// extending this one may replace.
+type BlockNode struct {
+	NodeType
+	Pos
+	Line int
+	Name string
+	List *ListNode // The default content of the block.
+}
+
+func newBlock(pos Pos, line int, name string, list *ListNode) *BlockNode {
+	return &BlockNode{NodeType: NodeBlock, Pos: pos, Line: line, Name: name, List: list}
 }
 
-func (i *ParentNode) Copy() Node {
-	return newParent(i.Ident).SetPos(i.Pos)
+func (b *BlockNode) String() string {
+	return fmt.Sprintf("{{$%s}}%s{{/%s}}", b.Name, b.List, b.Name)
+}
+
+func (b *BlockNode) Copy() Node {
+	return newBlock(b.Pos, b.Line, b.Name, b.List.CopyList())
 }
 
 // ListNode holds a sequence of nodes.
@@ -657,7 +747,12 @@ func (e *endNode) Type() NodeType {
 }
 
 func (e *endNode) String() string {
-	return fmt.Sprintf("{{\\%s}}", e.Name)
+	return fmt.Sprintf("{{/%s}}", e.Name)
+}
+
+// item returns the end tag as an item, for error reporting.
+func (e *endNode) item() item {
+	return item{typ: tagEndSection, pos: e.Pos, value: e.String()}
 }
 
 func (e *endNode) Copy() Node {
@@ -0,0 +1,598 @@
+// Copyright 2014 Joel Scoble (github:mohae). All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+//
+// This code is based on code originally written by The Go Authors.
+// Their copyright notice immediately follows this one.
+
+// Copyright 2011 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package parse builds parse trees for Mustache templates. Clients should
+// use the rollie package, which provides the API for rendering templates,
+// rather than this one.
+package parse
+
+import (
+	"fmt"
+	"runtime"
+	"strings"
+	"unicode/utf8"
+	"unsafe"
+)
+
+// Tree is the representation of a single parsed template.
+type Tree struct {
+	Name      string    // name of the template represented by the tree.
+	ParseName string    // name of the top-level template during parsing, for error messages.
+	Root      *ListNode // top-level root of the tree.
+	text      string    // text parsed to create the template.
+	// Parsing only; cleared after parse.
+	lex        *lexer
+	src        []byte // the text, if held in a byte slice, that text nodes refer to.
+	leftDelim  string // the current delimiters; set delimiter tags change them.
+	rightDelim string
+	line       []item // the remaining items of the current line.
+	lineBuf    []item // storage for line.
+	linePos    Pos    // a position whose line number is known, for lineOf.
+	lineNum    int
+	token      [3]item // three-token lookahead for parser.
+	peekCount  int
+}
+
+// Copy returns a copy of the Tree. Any parsing state is discarded.
+func (t *Tree) Copy() *Tree {
+	if t == nil {
+		return nil
+	}
+	return &Tree{
+		Name:      t.Name,
+		ParseName: t.ParseName,
+		Root:      t.Root.CopyList(),
+		text:      t.text,
+	}
+}
+
+// Parse returns the parse tree of the template, text, using the passed
+// delimiters. Empty delimiters are replaced with the Mustache defaults,
+// {{ and }}.
+func Parse(name, text, leftDelim, rightDelim string) (*Tree, error) {
+	return New(name).Parse(text, leftDelim, rightDelim)
+}
+
+// ParseBytes is like Parse, but the template is held in a byte slice. The
+// bytes are not copied: the tree refers to them, so they must not be
+// modified once ParseBytes has been called.
+func ParseBytes(name string, text []byte, leftDelim, rightDelim string) (*Tree, error) {
+	t := New(name)
+	t.src = text
+	return t.Parse(bytesToString(text), leftDelim, rightDelim)
+}
+
+// bytesToString returns the bytes as a string without copying them.
+func bytesToString(b []byte) string {
+	if len(b) == 0 {
+		return ""
+	}
+	return unsafe.String(unsafe.SliceData(b), len(b))
+}
+
+// New allocates a new parse tree with the given name.
+func New(name string) *Tree {
+	return &Tree{
+		Name: name,
+	}
+}
+
+// next returns the next token.
+func (t *Tree) next() item {
+	if t.peekCount > 0 {
+		t.peekCount--
+	} else {
+		t.token[0] = t.nextItem()
+	}
+	return t.token[t.peekCount]
+}
+
+// backup backs the input stream up one token.
+func (t *Tree) backup() {
+	t.peekCount++
+}
+
+// peek returns but does not consume the next token.
+func (t *Tree) peek() item {
+	if t.peekCount > 0 {
+		return t.token[t.peekCount-1]
+	}
+	t.peekCount = 1
+	t.token[0] = t.nextItem()
+	return t.token[0]
+}
+
+// nextItem returns the next item from the lexer. Items are read a line at a
+// time so that the whitespace surrounding standalone tags can be removed
+// before the parser sees it.
+func (t *Tree) nextItem() item {
+	if len(t.line) == 0 {
+		t.readLine()
+	}
+	it := t.line[0]
+	t.line = t.line[1:]
+	return it
+}
+
+// readLine reads the items of the next line, up to and including its
+// newline or the EOF, into the line buffer. If the line is standalone, the
+// whitespace around its tag and its line ending are dropped.
+func (t *Tree) readLine() {
+	// The buffer is reused; the parser has consumed the previous line.
+	line := t.lineBuf[:0]
+	for {
+		it := t.lex.nextItem()
+		line = append(line, it)
+		if it.typ == itemNL || it.typ == EOF || it.typ == ERROR {
+			break
+		}
+	}
+	t.lineBuf = line
+	if start, end, ok := standalone(line); ok {
+		last := line[len(line)-1]
+		// A standalone partial's, or parent's, indentation is applied to
+		// each line of the template it includes, so it is passed on to
+		// the parser in place of the leading whitespace.
+		if line[start].typ == tagPartial || line[start].typ == tagParent {
+			it := item{typ: itemIndent, pos: line[0].pos}
+			if start > 0 {
+				it.value = line[0].value
+				start--
+				line[start] = it
+			} else {
+				line = append([]item{it}, line[:end]...)
+				end++
+			}
+		}
+		line = line[start:end]
+		if last.typ == EOF {
+			line = append(line, last)
+		}
+	}
+	t.line = line
+}
+
+// standalone reports whether the line holds nothing but a single section,
+// inverted section, end section, comment, partial, set delimiter or block
+// tag, optionally surrounded by whitespace. Such tags are standalone: their
+// line does not appear in the output. The tags of a parent, e.g.
+// {{<parent}}{{/parent}}, and the blocks within it may share a standalone
+// line. start and end bound the tags' items.
+func standalone(line []item) (start, end int, ok bool) {
+	i := 0
+	if line[i].typ == itemSpace {
+		i++
+	}
+	start = i
+	tags := 0
+	parent := false
+	for i < len(line) && isStandaloneTag(line[i].typ) {
+		if line[i].typ == tagParent {
+			parent = true
+		}
+		// the tag's contents, if any, and its closing delimiter.
+		for i++; i < len(line) && line[i].typ != itemCTag; i++ {
+			if line[i].typ != itemIdentifier && line[i].typ != itemDiscard && !isMarker(line[i].typ) {
+				return 0, 0, false
+			}
+		}
+		if i == len(line) {
+			return 0, 0, false
+		}
+		i++
+		tags++
+	}
+	if tags == 0 || (tags > 1 && !parent) {
+		return 0, 0, false
+	}
+	end = i
+	// only whitespace may follow the tags before the end of the line.
+	if i < len(line) && line[i].typ == itemSpace {
+		i++
+	}
+	if i < len(line) && line[i].typ == itemCR {
+		i++
+	}
+	if i != len(line)-1 || (line[i].typ != itemNL && line[i].typ != EOF) {
+		return 0, 0, false
+	}
+	return start, end, true
+}
+
+// isMarker reports whether typ is one of the iteration markers, e.g.
+// -first, which are names that the renderer provides within list sections.
+func isMarker(typ itemType) bool {
+	switch typ {
+	case markerIndex, markerFirst, markerLast, markerOdd:
+		return true
+	}
+	return false
+}
+
+// isStandaloneTag reports whether a tag of type typ may be standalone.
+func isStandaloneTag(typ itemType) bool {
+	switch typ {
+	case tagSection, tagInverted, tagEndSection, tagComment, tagPartial, tagΔDelimiter, tagParent, tagBlock:
+		return true
+	}
+	return false
+}
+
+// Parsing.
+
+// lineOf returns the line number of the passed position. As positions
+// mostly increase during a parse, counting starts from the last position
+// asked about.
+func (t *Tree) lineOf(pos Pos) int {
+	if pos < t.linePos || t.lineNum == 0 {
+		t.linePos, t.lineNum = 0, 1
+	}
+	t.lineNum += strings.Count(t.text[t.linePos:pos], "\n")
+	t.linePos = pos
+	return t.lineNum
+}
+
+// Error describes a problem parsing a template. It is returned, as a
+// *Error, by Parse.
+type Error struct {
+	Name    string // Name of the template being parsed.
+	Line    int    // Line of the error, starting at 1.
+	Column  int    // Column of the error, in runes, starting at 1.
+	Item    string // The offending item, quoted; empty for lexing errors.
+	Msg     string // Description of the problem.
+	Snippet string // The line of the error with a caret under the column.
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("rollie: %s:%d:%d: %s", e.Name, e.Line, e.Column, e.Msg)
+}
+
+// errorf formats the error, positioned at the most recently read item, and
+// terminates processing.
+func (t *Tree) errorf(format string, args ...interface{}) {
+	t.errorAt(t.token[0], format, args...)
+}
+
+// errorAt formats the error, positioned at the passed item, and terminates
+// processing.
+func (t *Tree) errorAt(it item, format string, args ...interface{}) {
+	t.Root = nil
+	err := &Error{
+		Name: t.ParseName,
+		Line: t.lineOf(it.pos),
+		Msg:  fmt.Sprintf(format, args...),
+	}
+	if it.typ != ERROR {
+		err.Item = it.String()
+	}
+	// The snippet is the line holding the error, without its line ending,
+	// with a caret under the error. Tabs are kept so that the caret lines up.
+	start := strings.LastIndex(t.text[:it.pos], "\n") + 1
+	end := strings.IndexByte(t.text[it.pos:], '\n')
+	if end < 0 {
+		end = len(t.text)
+	} else {
+		end += int(it.pos)
+	}
+	prefix := t.text[start:it.pos]
+	err.Column = utf8.RuneCountInString(prefix) + 1
+	caret := strings.Map(func(r rune) rune {
+		if r == '\t' {
+			return r
+		}
+		return ' '
+	}, prefix)
+	err.Snippet = strings.TrimSuffix(t.text[start:end], "\r") + "\n" + caret + "^"
+	panic(err)
+}
+
+// expect consumes the next token and guarantees it has the required type.
+func (t *Tree) expect(expected itemType, context string) item {
+	token := t.next()
+	if token.typ != expected {
+		t.unexpected(token, context)
+	}
+	return token
+}
+
+// unexpected complains about the token and terminates processing.
+func (t *Tree) unexpected(token item, context string) {
+	if token.typ == ERROR {
+		t.errorAt(token, "%s", token.value)
+	}
+	t.errorAt(token, "unexpected %s in %s", token, context)
+}
+
+// recover is the handler that turns panics into returns from the top level of Parse.
+func (t *Tree) recover(errp *error) {
+	e := recover()
+	if e != nil {
+		if _, ok := e.(runtime.Error); ok {
+			panic(e)
+		}
+		if t != nil {
+			t.stopParse()
+		}
+		*errp = e.(error)
+	}
+}
+
+// startParse initializes the parser, using the lexer.
+func (t *Tree) startParse(lex *lexer) {
+	t.Root = nil
+	t.lex = lex
+}
+
+// stopParse terminates parsing.
+func (t *Tree) stopParse() {
+	t.lex = nil
+	t.src = nil
+}
+
+// Parse parses the template definition string to construct a representation
+// of the template for execution. If either action delimiter string is empty,
+// the default ("{{" or "}}") is used.
+func (t *Tree) Parse(text, leftDelim, rightDelim string) (tree *Tree, err error) {
+	defer t.recover(&err)
+	t.ParseName = t.Name
+	t.text = text
+	if leftDelim == "" {
+		leftDelim = OTag
+	}
+	if rightDelim == "" {
+		rightDelim = CTag
+	}
+	t.leftDelim, t.rightDelim = leftDelim, rightDelim
+	t.startParse(lex(t.Name, text, leftDelim, rightDelim))
+	t.parse()
+	t.stopParse()
+	return t, nil
+}
+
+// parse is the top-level parser for a template. It runs to EOF.
+func (t *Tree) parse() {
+	t.Root = newList(t.peek().pos)
+	for t.peek().typ != EOF {
+		switch n := t.textOrTag(); n := n.(type) {
+		case nil:
+		case *endNode:
+			t.errorAt(n.item(), "unexpected %s", n)
+		default:
+			t.Root.append(n)
+		}
+	}
+}
+
+// itemList parses the contents of a section until its end tag, which must
+// match name. The end tag is returned with the list.
+func (t *Tree) itemList(name string) (*ListNode, *endNode) {
+	list := newList(t.peek().pos)
+	for t.peek().typ != EOF {
+		switch n := t.textOrTag(); n := n.(type) {
+		case nil:
+		case *endNode:
+			if n.Name != name {
+				t.errorAt(n.item(), "unexpected %s; expected {{/%s}}", n, name)
+			}
+			return list, n
+		default:
+			list.append(n)
+		}
+	}
+	t.errorf("unclosed section %q", name)
+	return list, nil
+}
+
+// bytes returns the text of the token. If the template is held in a byte
+// slice, it is a subslice of it, so that the text isn't copied.
+func (t *Tree) bytes(token item) []byte {
+	if t.src == nil {
+		return []byte(token.value)
+	}
+	end := int(token.pos) + len(token.value)
+	return t.src[token.pos:end:end]
+}
+
+// textOrTag returns the next node. Tags that don't produce a node, e.g. set
+// delimiter, return nil.
+//
+//	text | space | newline | tag
+func (t *Tree) textOrTag() Node {
+	switch token := t.next(); token.typ {
+	case itemText:
+		return newText(token.pos, t.bytes(token))
+	case itemSpace:
+		return newSpace(token.pos, t.bytes(token))
+	case itemNL:
+		return newNL(token.pos, t.bytes(token))
+	case itemCR:
+		return newCR(token.pos, t.bytes(token))
+	case tagEscaped, tagUnescaped:
+		return t.variable(token)
+	case tagComment:
+		return t.comment(token)
+	case markerText:
+		return t.literal(token)
+	case tagSection, tagInverted:
+		return t.section(token)
+	case tagEndSection:
+		return t.endSection(token)
+	case tagPartial:
+		return t.partial(token)
+	case tagParent:
+		return t.parent(token)
+	case tagBlock:
+		return t.block(token)
+	case itemIndent:
+		switch tag := t.next(); tag.typ {
+		case tagPartial:
+			p := t.partial(tag)
+			p.Standalone = true
+			p.Indent = token.value
+			return p
+		case tagParent:
+			p := t.parent(tag)
+			p.Standalone = true
+			p.Indent = token.value
+			return p
+		default:
+			t.unexpected(tag, "standalone partial")
+		}
+	case tagΔDelimiter:
+		// The lexer has already switched delimiters; there is nothing to add
+		// to the tree, but sections record the delimiters they were
+		// written with.
+		end := t.expect(itemCTag, "set delimiter")
+		delims := strings.Fields(t.text[token.pos+Pos(len(token.value)) : end.pos-1])
+		t.leftDelim, t.rightDelim = delims[0], delims[1]
+		return nil
+	default:
+		t.unexpected(token, "input")
+	}
+	return nil
+}
+
+// identifier consumes the name within a tag and its closing delimiter,
+// which is returned with the name. The name may be an iteration marker. If
+// dotted is set, the name is that of a variable or section, whose fields,
+// separated by dots, can't be empty.
+func (t *Tree) identifier(typ itemType, context string, dotted bool) (string, item) {
+	token := t.next()
+	if token.typ == itemCTag {
+		t.errorf("missing name in %s", context)
+	}
+	if token.typ != typ && !isMarker(token.typ) {
+		t.unexpected(token, context)
+	}
+	cTag := t.expect(itemCTag, context)
+	name := strings.TrimSpace(token.value)
+	if name == "" {
+		t.errorf("missing name in %s", context)
+	}
+	if dotted && name != "." {
+		// The error is positioned at the dot before, or after, the
+		// empty field.
+		pos := token.pos + Pos(strings.Index(token.value, name))
+		for i, field := range strings.Split(name, ".") {
+			if field == "" {
+				if i > 0 {
+					pos--
+				}
+				t.errorAt(item{typ: token.typ, pos: pos, value: token.value}, "empty field in name %q in %s", name, context)
+			}
+			pos += Pos(len(field)) + 1
+		}
+	}
+	return name, cTag
+}
+
+// variable:
+//
+//	{{name}} | {{{name}}} | {{&name}} | {{.}} | {{{.}}} | {{&.}}
+func (t *Tree) variable(tag item) Node {
+	typ := identEscaped
+	if tag.typ == tagUnescaped {
+		typ = identUnescaped
+	}
+	if t.peek().typ == markerDot {
+		t.next()
+		t.expect(itemCTag, "variable")
+		return newDot(typ, tag.pos, t.lineOf(tag.pos))
+	}
+	name, _ := t.identifier(typ, "variable", true)
+	return newVariable(typ, tag.pos, t.lineOf(tag.pos), name)
+}
+
+// comment:
+//
+//	{{!comment}}
+func (t *Tree) comment(tag item) Node {
+	var text string
+	if token := t.next(); token.typ == itemDiscard {
+		text = token.value
+	} else {
+		t.backup()
+	}
+	t.expect(itemCTag, "comment")
+	return newComment(tag.pos, t.lineOf(tag.pos), text)
+}
+
+// literal:
+//
+//	{{"text}}
+func (t *Tree) literal(tag item) Node {
+	var text []byte
+	if token := t.next(); token.typ == itemText {
+		text = t.bytes(token)
+	} else {
+		t.backup()
+	}
+	t.expect(itemCTag, "literal text")
+	return newText(tag.pos, text)
+}
+
+// section:
+//
+//	{{#name}} itemList {{/name}} | {{^name}} itemList {{/name}}
+func (t *Tree) section(tag item) Node {
+	context := "section"
+	if tag.typ == tagInverted {
+		context = "inverted section"
+	}
+	leftDelim, rightDelim := t.leftDelim, t.rightDelim
+	line := t.lineOf(tag.pos)
+	name, cTag := t.identifier(itemIdentifier, context, true)
+	list, end := t.itemList(name)
+	if tag.typ == tagInverted {
+		return newInverted(tag.pos, line, name, list)
+	}
+	sec := newSection(tag.pos, line, name, list)
+	// Lambdas are passed the unrendered source of the section.
+	sec.Text = t.text[cTag.pos+Pos(len(cTag.value)) : end.Pos]
+	sec.LeftDelim, sec.RightDelim = leftDelim, rightDelim
+	return sec
+}
+
+// endSection:
+//
+//	{{/name}}
+func (t *Tree) endSection(tag item) Node {
+	name, _ := t.identifier(itemIdentifier, "end section", true)
+	return newEnd(tag.pos, name)
+}
+
+// partial:
+//
+//	{{>name}}
+func (t *Tree) partial(tag item) *PartialNode {
+	name, _ := t.identifier(itemIdentifier, "partial", false)
+	return newPartial(tag.pos, t.lineOf(tag.pos), name)
+}
+
+// parent:
+//
+//	{{<name}} itemList {{/name}}
+func (t *Tree) parent(tag item) *ParentNode {
+	line := t.lineOf(tag.pos)
+	name, _ := t.identifier(itemIdentifier, "parent", false)
+	list, _ := t.itemList(name)
+	return newParent(tag.pos, line, name, list)
+}
+
+// block:
+//
+//	{{$name}} itemList {{/name}}
+func (t *Tree) block(tag item) Node {
+	line := t.lineOf(tag.pos)
+	name, _ := t.identifier(itemIdentifier, "block", false)
+	list, _ := t.itemList(name)
+	return newBlock(tag.pos, line, name, list)
+}
@@ -0,0 +1,262 @@
+// Copyright 2014 Joel Scoble (github:mohae). All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+//
+// This code is based on code originally written by The Go Authors.
+// Their copyright notice immediately follows this one.
+
+// Copyright 2011 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package parse
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"unsafe"
+)
+
+type parseTest struct {
+	name   string
+	input  string
+	ok     bool
+	result string // what the user would see in an error message.
+}
+
+const (
+	noError  = true
+	hasError = false
+)
+
+var parseTests = []parseTest{
+	{"empty", "", noError, ``},
+	{"text", "some text", noError, `some text`},
+	{"newlines", "a\r\nb\n", noError, "a\r\nb\n"},
+	{"comment", "a{{! a comment }}b", noError, `a{{! a comment }}b`},
+	{"empty comment", "{{!}}", noError, `{{!}}`},
+	{"escaped", "Hello {{ name }}!", noError, `Hello {{name}}!`},
+	{"unescaped", "{{{name}}} {{&name}}", noError, `{{{name}}} {{{name}}}`},
+	{"ampersand brace", "{{&name}}}", noError, `{{{name}}}}`},
+	{"triple delimiters", "{{=<% %>=}}<%{name}%>", noError, `{{{name}}}`},
+	{"dotted", "{{a.b.c}}", noError, `{{a.b.c}}`},
+	{"dot", "{{.}} {{ . }} {{{.}}} {{& .}}", noError, `{{.}} {{.}} {{{.}}} {{{.}}}`},
+	{"markers", "{{#l}}{{-index}}{{#-first}}f{{/-first}}{{^-last}},{{/-last}}{{#-odd}}o{{/-odd}}{{/l}}", noError, `{{#l}}{{-index}}{{#-first}}f{{/-first}}{{^-last}},{{/-last}}{{#-odd}}o{{/-odd}}{{/l}}`},
+	{"standalone marker", "{{#-first}}\nx\n{{/-first}}\n", noError, "{{#-first}}x\n{{/-first}}"},
+	{"literal", `a{{"{{x}}}} b{{"}}`, noError, `a{{x}} b`},
+	{"literal delimiters", `{{=<% %>=}}<%"<%x%>%>`, noError, `<%x%>`},
+	{"literal quotes", `{{""x" }}`, noError, `"x" `},
+	{"dot section", "{{#.}}x{{/.}}", noError, `{{#.}}x{{/.}}`},
+	{"dots in text", "a.b. {{.}}.", noError, `a.b. {{.}}.`},
+	{"section", "{{#list}}{{item}}{{/list}}", noError, `{{#list}}{{item}}{{/list}}`},
+	{"inverted", "{{^list}}none{{/list}}", noError, `{{^list}}none{{/list}}`},
+	{"nested", "{{#a}}{{#b}}{{c}}{{/b}}{{^d}}x{{/d}}{{/a}}", noError, `{{#a}}{{#b}}{{c}}{{/b}}{{^d}}x{{/d}}{{/a}}`},
+	{"section spaces", "{{# a }}x{{/ a }}", noError, `{{#a}}x{{/a}}`},
+	{"partial", "{{>part}}", noError, `{{>part}}`},
+	{"delimiter", "{{=<% %>=}}<%name%>", noError, `{{name}}`},
+	{"parent", "{{<layout}}{{$title}}x{{/title}}{{/layout}}", noError, `{{<layout}}{{$title}}x{{/title}}{{/layout}}`},
+	{"block", "{{$title}}default{{/title}}", noError, `{{$title}}default{{/title}}`},
+	// standalone tags lose their line's whitespace and line ending.
+	{"standalone section", "a\n  {{#b}}  \nc\n{{/b}}\r\nd", noError, "a\n{{#b}}c\n{{/b}}d"},
+	{"standalone comment", "  {{! comment }}\n", noError, "{{! comment }}"},
+	{"standalone partial", "\t{{>p}}", noError, "{{>p}}"},
+	{"standalone delimiter", "{{=| |=}}\n|a|", noError, "{{a}}"},
+	{"not standalone text", "a {{#b}}\n{{/b}}", noError, "a {{#b}}\n{{/b}}"},
+	{"not standalone variable", "  {{a}}\n", noError, "  {{a}}\n"},
+	{"not standalone two tags", "{{#a}}{{/a}}\n", noError, "{{#a}}{{/a}}\n"},
+	{"not standalone lone cr", "{{!a}}\rb", noError, "{{!a}}\rb"},
+	{"standalone parent", "a\n {{<p}}{{$b}}\nc\n{{/b}}\n{{/p}}\n", noError, "a\n{{<p}}{{$b}}c\n{{/b}}{{/p}}"},
+	{"standalone block", "  {{$b}}\nc\n  {{/b}}\n", noError, "{{$b}}c\n{{/b}}"},
+	// errors
+	{"unclosed section", "{{#a}}", hasError, ""},
+	{"mismatched section", "{{#a}}{{/b}}", hasError, ""},
+	{"unopened section", "x{{/a}}", hasError, ""},
+	{"empty variable", "{{}}", hasError, ""},
+	{"empty section", "{{#}}{{/}}", hasError, ""},
+	{"unclosed variable", "{{name", hasError, ""},
+	{"unbalanced triple", "{{{name}}", hasError, ""},
+	{"unclosed comment", "{{!name", hasError, ""},
+	{"unclosed literal", `{{"x`, hasError, ""},
+	{"unclosed parent", "{{<p}}", hasError, ""},
+	{"mismatched block", "{{$a}}{{/b}}", hasError, ""},
+	{"unclosed delimiter", "{{=<% %>", hasError, ""},
+	{"bad delimiter", "a\n{{=<%%>=}}", hasError, ""},
+}
+
+func TestParse(t *testing.T) {
+	for _, test := range parseTests {
+		tmpl, err := New(test.name).Parse(test.input, "", "")
+		switch {
+		case err == nil && !test.ok:
+			t.Errorf("%q: expected error; got none", test.name)
+			continue
+		case err != nil && test.ok:
+			t.Errorf("%q: unexpected error: %v", test.name, err)
+			continue
+		case err != nil && !test.ok:
+			// expected error, got one
+			continue
+		}
+		result := tmpl.Root.String()
+		if result != test.result {
+			t.Errorf("%s=(%q): got\n\t%v\nexpected\n\t%v", test.name, test.input, result, test.result)
+		}
+	}
+}
+
+func TestParseTree(t *testing.T) {
+	tree, err := Parse("tree", "{{#a}}x\n{{b}}{{/a}}", "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tree.Root.Nodes) != 1 {
+		t.Fatalf("expected 1 root node, got %d", len(tree.Root.Nodes))
+	}
+	s, ok := tree.Root.Nodes[0].(*SectionNode)
+	if !ok {
+		t.Fatalf("expected *SectionNode, got %T", tree.Root.Nodes[0])
+	}
+	if s.Name() != "a" {
+		t.Errorf("expected section name %q, got %q", "a", s.Name())
+	}
+	if len(s.List.Nodes) != 3 {
+		t.Fatalf("expected 3 nodes in section, got %d", len(s.List.Nodes))
+	}
+	v, ok := s.List.Nodes[2].(*VariableNode)
+	if !ok {
+		t.Fatalf("expected *VariableNode, got %T", s.List.Nodes[2])
+	}
+	if v.Line != 2 {
+		t.Errorf("expected variable on line 2, got %d", v.Line)
+	}
+}
+
+func TestSectionText(t *testing.T) {
+	tree, err := Parse("text", "{{=<% %>=}}<%#a%> x <%b%>\n<%/a%>", "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, ok := tree.Root.Nodes[0].(*SectionNode)
+	if !ok {
+		t.Fatalf("expected *SectionNode, got %T", tree.Root.Nodes[0])
+	}
+	if s.Text != " x <%b%>\n" {
+		t.Errorf("expected section text %q, got %q", " x <%b%>\n", s.Text)
+	}
+	if s.LeftDelim != "<%" || s.RightDelim != "%>" {
+		t.Errorf("expected delimiters %q %q, got %q %q", "<%", "%>", s.LeftDelim, s.RightDelim)
+	}
+}
+
+func TestParseBytes(t *testing.T) {
+	b := []byte("a {{#b}}c{{/b}}")
+	tree, err := ParseBytes("bytes", b, "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := tree.Root.String(); got != string(b) {
+		t.Errorf("expected %q, got %q", b, got)
+	}
+	// The tree refers to the bytes rather than a copy of them.
+	if unsafe.StringData(tree.text) != &b[0] {
+		t.Error("expected the parsed text to share the byte slice's memory")
+	}
+	// As do its text nodes, which can't be appended to over the bytes after them.
+	text := tree.Root.Nodes[0].(*TextNode).Text
+	if &text[0] != &b[0] || cap(text) != 1 {
+		t.Errorf("expected the text node to be a subslice of the bytes, got %q with cap %d", text, cap(text))
+	}
+	if tree, err = ParseBytes("empty", nil, "", ""); err != nil || len(tree.Root.Nodes) != 0 {
+		t.Errorf("empty input: got %v, %v", tree, err)
+	}
+}
+
+func TestParseErrorMessage(t *testing.T) {
+	_, err := Parse("msg", "line1\n{{#a}}{{/b}}", "", "")
+	if err == nil {
+		t.Fatal("expected error; got none")
+	}
+	for _, want := range []string{"msg:2", "{{/b}}", "{{/a}}"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("expected error to contain %q: %v", want, err)
+		}
+	}
+}
+
+func TestParseError(t *testing.T) {
+	tests := []struct {
+		input   string
+		line    int
+		column  int
+		item    string
+		snippet string
+	}{
+		{"line1\n\tx {{#a}}{{/b}}\r\nline3", 2, 10, `"{{/b}}"`, "\tx {{#a}}{{/b}}\n\t        ^"},
+		{"x{{/a}}", 1, 2, `"{{/a}}"`, "x{{/a}}\n ^"},
+		{"ä {{#a}}", 1, 9, "EOF", "ä {{#a}}\n        ^"},
+		{"a\n{{=<%%>=}}", 2, 4, "", "{{=<%%>=}}\n   ^"},
+		// Empty fields of dotted names are positioned at their dots.
+		{"{{a.}}", 1, 4, `"a."`, "{{a.}}\n   ^"},
+		{"{{ .a }}", 1, 4, `" .a "`, "{{ .a }}\n   ^"},
+		{"{{#a..b}}{{/a..b}}", 1, 5, `"a..b"`, "{{#a..b}}{{/a..b}}\n    ^"},
+	}
+	for _, test := range tests {
+		_, err := Parse("err", test.input, "", "")
+		var perr *Error
+		if !errors.As(err, &perr) {
+			t.Errorf("%q: expected *Error, got %T: %v", test.input, err, err)
+			continue
+		}
+		if perr.Name != "err" || perr.Line != test.line || perr.Column != test.column || perr.Item != test.item {
+			t.Errorf("%q: got %s %d:%d %s, expected err %d:%d %s", test.input, perr.Name, perr.Line, perr.Column, perr.Item, test.line, test.column, test.item)
+		}
+		if perr.Snippet != test.snippet {
+			t.Errorf("%q: got snippet\n%s\nexpected\n%s", test.input, perr.Snippet, test.snippet)
+		}
+	}
+}
+
+func TestPartialIndent(t *testing.T) {
+	tests := []struct {
+		input      string
+		standalone bool
+		indent     string
+	}{
+		{"{{>p}}", true, ""},
+		{"  {{>p}}\n", true, "  "},
+		{"a\n\t {{>p}}\r\nb", true, "\t "},
+		{"  {{>p}} x\n", false, ""},
+		{"x {{>p}}\n", false, ""},
+	}
+	for _, test := range tests {
+		tree, err := Parse("indent", test.input, "", "")
+		if err != nil {
+			t.Errorf("%q: unexpected error: %s", test.input, err)
+			continue
+		}
+		var p *PartialNode
+		for _, n := range tree.Root.Nodes {
+			if n, ok := n.(*PartialNode); ok {
+				p = n
+			}
+		}
+		if p == nil {
+			t.Errorf("%q: no partial found", test.input)
+			continue
+		}
+		if p.Standalone != test.standalone || p.Indent != test.indent {
+			t.Errorf("%q: got standalone %v indent %q, expected %v %q", test.input, p.Standalone, p.Indent, test.standalone, test.indent)
+		}
+	}
+}
+
+func BenchmarkParse(b *testing.B) {
+	b.SetBytes(int64(len(benchTemplate)))
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := Parse("bench", benchTemplate, "", ""); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,354 @@
+// Copyright 2014 Joel Scoble (github:mohae). All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package rollie
+
+import (
+	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// Names are resolved within a value as follows. A method, of the value or
+// of a pointer to it, that takes no arguments and returns a single value,
+// or a value and an error, is called; a non-nil error stops rendering.
+// Otherwise a map's key is used or a struct's exported field, including
+// those promoted from exported embedded structs. A field's name is that of
+// its mustache tag, e.g. `mustache:"name"`, or, if it has none, of its json
+// tag, or else its Go name; a mustache tag of "-" hides the field. Tag
+// names must match exactly; methods and Go names match regardless of case.
+// As with encoding/json, a field hides those of the same name that are more
+// deeply embedded, and fields of the same name at the same depth hide each
+// other unless exactly one of them is tagged.
+
+// lookupName returns the value of the named method, map key or struct
+// field of v, dereferencing pointers and interfaces as needed. The members
+// that name resolves to are taken from cache, if it isn't nil.
+func (s *state) lookupName(v reflect.Value, name string, cache *memberCache) (reflect.Value, bool) {
+	for v.Kind() == reflect.Interface && !v.IsNil() {
+		v = v.Elem()
+	}
+	if !v.IsValid() || (v.Kind() == reflect.Ptr && v.IsNil()) {
+		return reflect.Value{}, false
+	}
+	// Pointer methods are only in the method set of the pointer.
+	if v.Kind() != reflect.Ptr && v.CanAddr() {
+		v = v.Addr()
+	}
+	m := cache.member(v.Type(), name)
+	if m.method >= 0 {
+		if nilEmbedded(v, m.embed) {
+			return reflect.Value{}, false
+		}
+		out := v.Method(m.method).Call(nil)
+		if len(out) == 2 && !out[1].IsNil() {
+			s.errorf("calling %s: %w", name, out[1].Interface().(error))
+		}
+		return out[0], true
+	}
+	v = indirect(v)
+	switch v.Kind() {
+	case reflect.Map:
+		if !m.key.IsValid() {
+			return reflect.Value{}, false
+		}
+		// MapIndex copies values that aren't pointers, such as
+		// interfaces, so the most common map is indexed directly.
+		if v.Type() == genericMapType && v.CanInterface() {
+			if val := v.Interface().(map[string]interface{})[name]; val != nil {
+				return reflect.ValueOf(val), true
+			}
+		}
+		if val := v.MapIndex(m.key); val.IsValid() {
+			return val, true
+		}
+	case reflect.Struct:
+		if m.field != nil {
+			return fieldByIndex(v, m.field)
+		}
+	}
+	return reflect.Value{}, false
+}
+
+var genericMapType = reflect.TypeOf(map[string]interface{}(nil))
+
+// nilEmbedded reports whether any of the embedded fields of v, on the path
+// given by their index, is a nil pointer or interface.
+func nilEmbedded(v reflect.Value, index []int) bool {
+	for _, x := range index {
+		v = indirect(v)
+		v = v.Field(x)
+		if (v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface) && v.IsNil() {
+			return true
+		}
+	}
+	return false
+}
+
+// fieldByIndex returns the nested field of v, a struct, reporting false if
+// it is within a nil embedded pointer.
+func fieldByIndex(v reflect.Value, index []int) (reflect.Value, bool) {
+	for i, x := range index {
+		if i > 0 && v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				return reflect.Value{}, false
+			}
+			v = v.Elem()
+		}
+		v = v.Field(x)
+	}
+	return v, true
+}
+
+// member is what a name resolves to for a type: a method, by its index in
+// the type's method set, and, for structs and pointers to them, an exported
+// field. For maps with string keys, it holds the name as a key.
+type member struct {
+	typ    reflect.Type
+	method int           // index of the method, or -1
+	embed  []int         // index of the embedded field the method is promoted from
+	field  []int         // index of the field, or nil
+	key    reflect.Value // the name converted to the map's key type
+}
+
+type memberKey struct {
+	typ  reflect.Type
+	name string
+}
+
+// members caches the member for each type and name that has been looked
+// up, so that the methods and fields of a type are only searched once.
+var members sync.Map // map[memberKey]*member
+
+var errorType = reflect.TypeOf((*error)(nil)).Elem()
+
+// memberOf returns the member that name resolves to for typ.
+func memberOf(typ reflect.Type, name string) *member {
+	key := memberKey{typ, name}
+	if m, ok := members.Load(key); ok {
+		return m.(*member)
+	}
+	m := &member{typ: typ, method: -1}
+	for i := 0; i < typ.NumMethod(); i++ {
+		meth := typ.Method(i)
+		if strings.EqualFold(meth.Name, name) {
+			out := meth.Type.NumOut()
+			if meth.Type.NumIn() == 1 && (out == 1 || out == 2 && meth.Type.Out(1) == errorType) {
+				m.method = i
+				m.embed = methodPath(typ, meth.Name)
+			}
+			break
+		}
+	}
+	st := typ
+	for st.Kind() == reflect.Ptr {
+		st = st.Elem()
+	}
+	switch st.Kind() {
+	case reflect.Struct:
+		m.field = fieldOf(st, name)
+	case reflect.Map:
+		if st.Key().Kind() == reflect.String {
+			m.key = reflect.ValueOf(name).Convert(st.Key())
+		}
+	}
+	members.Store(key, m)
+	return m
+}
+
+// methodPath returns the index of the embedded field, of typ or of the
+// struct it points to, that the named method is promoted from, or nil if
+// it isn't promoted. A method declared by a struct that also embeds one of
+// the same name is taken to be promoted.
+func methodPath(typ reflect.Type, name string) []int {
+	var index []int
+	for {
+		for typ.Kind() == reflect.Ptr {
+			typ = typ.Elem()
+		}
+		if typ.Kind() != reflect.Struct {
+			return index
+		}
+		next := -1
+		for i := 0; i < typ.NumField() && next < 0; i++ {
+			if sf := typ.Field(i); sf.Anonymous && hasMethod(sf.Type, name) {
+				next = i
+			}
+		}
+		if next < 0 {
+			return index
+		}
+		index = append(index, next)
+		typ = typ.Field(next).Type
+	}
+}
+
+// hasMethod reports whether typ, or a pointer to it, has the named method.
+func hasMethod(typ reflect.Type, name string) bool {
+	if _, ok := typ.MethodByName(name); ok {
+		return true
+	}
+	if typ.Kind() == reflect.Ptr || typ.Kind() == reflect.Interface {
+		return false
+	}
+	_, ok := reflect.PointerTo(typ).MethodByName(name)
+	return ok
+}
+
+// maxCached is the number of types a memberCache holds members for.
+const maxCached = 4
+
+// A memberCache holds the members that a field of a compiled tag's name
+// has resolved to, for the first few types it was resolved within, so that
+// rendering the tag again needn't search members.
+type memberCache struct {
+	seen atomic.Pointer[[]*member]
+}
+
+// member returns the member that name resolves to for typ. c may be nil.
+func (c *memberCache) member(typ reflect.Type, name string) *member {
+	if c == nil {
+		return memberOf(typ, name)
+	}
+	seen := c.seen.Load()
+	if seen != nil {
+		for _, m := range *seen {
+			if m.typ == typ {
+				return m
+			}
+		}
+	}
+	m := memberOf(typ, name)
+	if seen == nil || len(*seen) < maxCached {
+		// The cache is replaced, not changed, as it may be read by
+		// concurrent renders; a member added concurrently may be lost.
+		var ms []*member
+		if seen != nil {
+			ms = append(ms, *seen...)
+		}
+		ms = append(ms, m)
+		c.seen.Store(&ms)
+	}
+	return m
+}
+
+// field is a field of a struct, as seen by templates.
+type field struct {
+	name   string
+	tagged bool
+	index  []int
+}
+
+// fields caches the fields of each struct type that has been looked up.
+var fields sync.Map // map[reflect.Type][]field
+
+// fieldOf returns the index of the named field of typ, a struct, or nil.
+// A field whose name matches exactly is preferred to one whose name only
+// matches regardless of case.
+func fieldOf(typ reflect.Type, name string) []int {
+	var fold []int
+	for _, f := range typeFields(typ) {
+		if f.name == name {
+			return f.index
+		}
+		if fold == nil && !f.tagged && strings.EqualFold(f.name, name) {
+			fold = f.index
+		}
+	}
+	return fold
+}
+
+// typeFields returns the fields of typ, a struct, that templates can see:
+// its exported fields and those promoted from its exported embedded
+// structs, less those that are hidden.
+func typeFields(typ reflect.Type) []field {
+	if f, ok := fields.Load(typ); ok {
+		return f.([]field)
+	}
+	type embedded struct {
+		typ   reflect.Type
+		index []int
+	}
+	var all []field
+	// taken holds the names of the fields at shallower depths, which hide
+	// those deeper, even if they hide each other.
+	taken := map[string]bool{}
+	visited := map[reflect.Type]bool{}
+	next := []embedded{{typ: typ}}
+	// Each pass reads the fields one level of embedding deeper.
+	for len(next) > 0 {
+		level := next
+		next = nil
+		var found []field
+		count, tags := map[string]int{}, map[string]int{}
+		for _, e := range level {
+			if visited[e.typ] {
+				continue
+			}
+			visited[e.typ] = true
+			for i := 0; i < e.typ.NumField(); i++ {
+				sf := e.typ.Field(i)
+				if !sf.IsExported() {
+					continue
+				}
+				name, tagged := fieldName(sf)
+				if name == "-" {
+					continue
+				}
+				index := append(e.index[:len(e.index):len(e.index)], i)
+				ft := sf.Type
+				if ft.Kind() == reflect.Ptr {
+					ft = ft.Elem()
+				}
+				// An embedded struct's fields are promoted; it can
+				// also be referred to by its type's name.
+				if sf.Anonymous && !tagged && ft.Kind() == reflect.Struct {
+					next = append(next, embedded{ft, index})
+				}
+				found = append(found, field{name: name, tagged: tagged, index: index})
+				count[name]++
+				if tagged {
+					tags[name]++
+				}
+			}
+		}
+		for _, f := range found {
+			if taken[f.name] {
+				continue
+			}
+			// Fields of the same name hide each other, unless only
+			// one of them is tagged.
+			if count[f.name] > 1 && (!f.tagged || tags[f.name] > 1) {
+				continue
+			}
+			all = append(all, f)
+		}
+		for _, f := range found {
+			taken[f.name] = true
+		}
+	}
+	fields.Store(typ, all)
+	return all
+}
+
+// fieldName returns the name of a struct field and whether it was given by
+// a tag.
+func fieldName(sf reflect.StructField) (string, bool) {
+	for _, key := range []string{"mustache", "json"} {
+		tag, ok := sf.Tag.Lookup(key)
+		if !ok {
+			continue
+		}
+		name, _, _ := strings.Cut(tag, ",")
+		if key == "json" && name == "-" {
+			// Hidden from JSON, but not from templates.
+			break
+		}
+		if name != "" {
+			return name, true
+		}
+	}
+	return sf.Name, false
+}
@@ -0,0 +1,127 @@
+// Copyright 2014 Joel Scoble (github:mohae). All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package rollie
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+)
+
+type Base struct {
+	ID    int
+	Title string `mustache:"heading"`
+	Depth string
+}
+
+func (b Base) Kind() string { return "base" }
+
+type Extra struct {
+	Depth string
+	Note  string
+}
+
+func (e *Extra) Summary() string { return e.Depth + ":" + e.Note }
+
+type inner struct {
+	Hidden string
+}
+
+type Tagged struct {
+	Base
+	*Extra
+	inner
+	Name    string `mustache:"name" json:"full_name"`
+	Email   string `json:"email,omitempty"`
+	Secret  string `mustache:"-"`
+	Skipped string `json:"-"`
+	A       string `mustache:"dup"`
+	B       string `mustache:"dup"`
+	One     string
+	D       string `json:"d" mustache:"One"`
+	private string
+}
+
+func (t *Tagged) Greeting() (string, error) { return "Hi " + t.Name, nil }
+
+func (t *Tagged) Fail() (string, error) { return "", errors.New("boom") }
+
+func (t *Tagged) Args(s string) string { return s }
+
+var resolveTests = []struct {
+	name  string
+	input string
+	out   string
+}{
+	{"mustache tag", "{{name}}", "Ann"},
+	{"mustache tag exact", "{{Name}}{{NAME}}", ""},
+	{"json tag", "{{email}}", "ann@example.com"},
+	{"hidden", "{{Secret}}{{secret}}", ""},
+	{"json hidden", "{{Skipped}}", "skipped"},
+	{"promoted", "{{ID}}{{heading}}", "7Boss"},
+	{"embedded by name", "{{Base.ID}}{{#Base}}{{Kind}}{{/Base}}", "7base"},
+	{"promoted method", "{{Kind}}", "base"},
+	{"embedded pointer", "{{Note}}", "note"},
+	{"embedded pointer method", "{{Summary}}", "extra:note"},
+	{"conflict at depth", "{{Depth}}", ""},
+	{"conflict untagged", "{{dup}}", ""},
+	{"conflict tagged", "{{One}}{{one}}", "d"},
+	{"unexported embedded", "{{Hidden}}", ""},
+	{"unexported", "{{private}}", ""},
+	{"error method", "{{Greeting}}", "Hi Ann"},
+	{"method with args", "{{Args}}", ""},
+}
+
+func newTagged() *Tagged {
+	return &Tagged{
+		Base:    Base{ID: 7, Title: "Boss", Depth: "base"},
+		Extra:   &Extra{Depth: "extra", Note: "note"},
+		inner:   inner{Hidden: "hidden"},
+		Name:    "Ann",
+		Email:   "ann@example.com",
+		Secret:  "secret",
+		Skipped: "skipped",
+		A:       "a",
+		B:       "b",
+		One:     "one",
+		D:       "d",
+		private: "private",
+	}
+}
+
+func TestResolve(t *testing.T) {
+	data := newTagged()
+	for _, test := range resolveTests {
+		tmpl := Must(New(test.name).Parse(test.input))
+		// Render twice, the second time with the cached members.
+		for i := 0; i < 2; i++ {
+			var b bytes.Buffer
+			if err := tmpl.Render(&b, data); err != nil {
+				t.Errorf("%s: %s", test.name, err)
+				break
+			}
+			if got := b.String(); got != test.out {
+				t.Errorf("%s: expected %q, got %q", test.name, test.out, got)
+				break
+			}
+		}
+	}
+}
+
+func TestResolveNilEmbedded(t *testing.T) {
+	data := newTagged()
+	data.Extra = nil
+	tmpl := Must(New("nil").Parse("[{{Note}}{{Summary}}]"))
+	testRender(t, tmpl, data, "[]")
+}
+
+func TestResolveMethodError(t *testing.T) {
+	tmpl := Must(New("fail").Parse("{{Fail}}"))
+	err := tmpl.Render(new(bytes.Buffer), newTagged())
+	if err == nil || !strings.Contains(err.Error(), "calling Fail: boom") {
+		t.Errorf("expected error calling Fail, got %v", err)
+	}
+}
@@ -0,0 +1,172 @@
+// Copyright 2014 Joel Scoble (github:mohae). All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package rollie
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+)
+
+// The Mustache spec, https://github.com/mustache/spec, is vendored in
+// testdata/spec. Optional modules, whose file names start with '~', are
+// only run when the -spec.optional flag is set:
+//
+//	go test -run TestSpec -spec.optional
+var specOptional = flag.Bool("spec.optional", false, "run the optional (~) Mustache spec modules")
+
+// specFiles are the required spec modules.
+var specFiles = []string{
+	"comments",
+	"delimiters",
+	"interpolation",
+	"inverted",
+	"partials",
+	"sections",
+}
+
+// specOptionalFiles are the optional spec modules.
+var specOptionalFiles = []string{
+	"~inheritance",
+	"~lambdas",
+}
+
+// specSkip holds the spec tests, by file and name, that exercise features
+// that are not implemented yet.
+var specSkip = map[string]map[string]bool{}
+
+// specLambdas are Go versions of the lambdas in the ~lambdas module, whose
+// data only holds source for other languages. They are keyed by test name;
+// each call returns a new lambda so that state isn't shared between runs.
+var specLambdas = map[string]func() interface{}{
+	"Interpolation": func() interface{} {
+		return func() string { return "world" }
+	},
+	"Interpolation - Expansion": func() interface{} {
+		return func() string { return "{{planet}}" }
+	},
+	"Interpolation - Alternate Delimiters": func() interface{} {
+		return func() string { return "|planet| => {{planet}}" }
+	},
+	"Interpolation - Multiple Calls": func() interface{} {
+		calls := 0
+		return func() string {
+			calls++
+			return strconv.Itoa(calls)
+		}
+	},
+	"Escaping": func() interface{} {
+		return func() string { return ">" }
+	},
+	"Section": func() interface{} {
+		return func(text string, render func(string) string) string {
+			if text == "{{x}}" {
+				return "yes"
+			}
+			return "no"
+		}
+	},
+	"Section - Expansion": func() interface{} {
+		return func(text string, render func(string) string) string {
+			return render(text + "{{planet}}" + text)
+		}
+	},
+	"Section - Alternate Delimiters": func() interface{} {
+		return func(text string, render func(string) string) string {
+			return render(text + "{{planet}} => |planet|" + text)
+		}
+	},
+	"Section - Multiple Calls": func() interface{} {
+		return func(text string, render func(string) string) string {
+			return "__" + text + "__"
+		}
+	},
+	"Inverted Section": func() interface{} {
+		return func(text string, render func(string) string) string { return "" }
+	},
+}
+
+type specFile struct {
+	Overview string     `json:"overview"`
+	Tests    []specTest `json:"tests"`
+}
+
+type specTest struct {
+	Name     string            `json:"name"`
+	Desc     string            `json:"desc"`
+	Data     interface{}       `json:"data"`
+	Template string            `json:"template"`
+	Expected string            `json:"expected"`
+	Partials map[string]string `json:"partials"`
+}
+
+func TestSpec(t *testing.T) {
+	files := specFiles
+	if *specOptional {
+		files = append(files, specOptionalFiles...)
+	}
+	for _, file := range files {
+		file := file
+		t.Run(file, func(t *testing.T) {
+			runSpecFile(t, file)
+		})
+	}
+}
+
+// runSpecFile runs every test in the named spec module as a subtest and
+// logs a summary of the results.
+func runSpecFile(t *testing.T, file string) {
+	b, err := os.ReadFile(filepath.Join("testdata", "spec", file+".json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var spec specFile
+	if err = json.Unmarshal(b, &spec); err != nil {
+		t.Fatalf("%s: %s", file, err)
+	}
+	var passed, failed, skipped int
+	for _, test := range spec.Tests {
+		test := test
+		if specSkip[file][test.Name] {
+			skipped++
+			t.Run(test.Name, func(t *testing.T) {
+				t.Skip("not implemented")
+			})
+			continue
+		}
+		if fn, ok := specLambdas[test.Name]; ok && file == "~lambdas" {
+			test.Data.(map[string]interface{})["lambda"] = fn()
+		}
+		if t.Run(test.Name, func(t *testing.T) { runSpecTest(t, &test) }) {
+			passed++
+		} else {
+			failed++
+		}
+	}
+	t.Logf("%s: %d passed, %d failed, %d skipped", file, passed, failed, skipped)
+}
+
+func runSpecTest(t *testing.T, test *specTest) {
+	tmpl := New(test.Name)
+	for name, partial := range test.Partials {
+		if _, err := tmpl.New(name).Parse(partial); err != nil {
+			t.Fatalf("%s: partial %q: %s", test.Desc, name, err)
+		}
+	}
+	if _, err := tmpl.Parse(test.Template); err != nil {
+		t.Fatalf("%s: %s", test.Desc, err)
+	}
+	b := new(bytes.Buffer)
+	if err := tmpl.Render(b, test.Data); err != nil {
+		t.Fatalf("%s: %s", test.Desc, err)
+	}
+	if b.String() != test.Expected {
+		t.Errorf("%s\ntemplate:\n\t%q\nexpected:\n\t%q\ngot:\n\t%q", test.Desc, test.Template, test.Expected, b.String())
+	}
+}
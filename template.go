@@ -0,0 +1,280 @@
+// Copyright 2014 Joel Scoble (github:mohae). All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+//
+// This code is based on code originally written by The Go Authors.
+// Their copyright notice immediately follows this one.
+
+// Copyright 2011 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package rollie implements Mustache templates: logic-less templates that
+// are rendered against arbitrary Go data.
+package rollie
+
+import (
+	"io"
+	"sync"
+	"sync/atomic"
+
+	"github.com/mohae/rollie/parse"
+)
+
+// common holds the information shared by related templates.
+type common struct {
+	tmpl   map[string]*Template
+	muTmpl sync.RWMutex // protects tmpl
+	loader PartialLoader
+	option option
+	// gen counts the definitions of the templates, so that what is
+	// cached about the set, e.g. the contexts of the ContextualEscaper,
+	// can be recomputed when it changes.
+	gen atomic.Uint64
+}
+
+// Template is the representation of a parsed Mustache template. The
+// *parse.Tree field is exported only for use by other packages, e.g.
+// tools, and should be treated as unexported by clients.
+type Template struct {
+	name string
+	*parse.Tree
+	*common
+	leftDelim  string
+	rightDelim string
+	escaper    Escaper                  // nil uses the escape option
+	compiled   atomic.Pointer[compiled] // the plan for Tree; see compile.go
+	escapes    atomic.Pointer[escapes]  // the contexts of Tree; see autoescape.go
+}
+
+// New allocates a new, undefined template with the given name.
+func New(name string) *Template {
+	t := &Template{
+		name: name,
+	}
+	t.init()
+	return t
+}
+
+// Name returns the name of the template.
+func (t *Template) Name() string {
+	return t.name
+}
+
+// New allocates a new, undefined template associated with the given one
+// and with the same delimiters and escaper. The association, which is
+// transitive, allows one template to render another as a partial.
+func (t *Template) New(name string) *Template {
+	t.init()
+	return &Template{
+		name:       name,
+		common:     t.common,
+		leftDelim:  t.leftDelim,
+		rightDelim: t.rightDelim,
+		escaper:    t.escaper,
+	}
+}
+
+// Delims sets the delimiters to the specified strings, to be used in
+// subsequent calls to Parse, ParseFiles, or ParseGlob, and by the partials
+// that t loads. Set delimiter tags, e.g. {{=<% %>=}}, within a template
+// change the delimiters for the rest of that template only. An empty
+// delimiter stands for the corresponding default: {{ or }}. The return
+// value is the template, so calls can be chained.
+func (t *Template) Delims(left, right string) *Template {
+	t.init()
+	t.leftDelim = left
+	t.rightDelim = right
+	return t
+}
+
+// Escaper sets the escaper of the values of t's escaped tags, and of those
+// of its partials when t is rendered. A nil escaper uses the set's escape
+// option, see Option. The return value is the template, so calls can be
+// chained.
+func (t *Template) Escaper(e Escaper) *Template {
+	t.init()
+	t.escaper = e
+	return t
+}
+
+// escaping returns the escaper used when t is rendered.
+func (t *Template) escaping() Escaper {
+	if t.escaper != nil {
+		return t.escaper
+	}
+	if t.option.escaper != nil {
+		return t.option.escaper
+	}
+	return HTMLEscaper
+}
+
+// Clone returns a duplicate of the template, including all associated
+// templates. The actual representation is not copied, but the name space of
+// associated templates is, so further calls to Parse in the copy will add
+// templates to the copy but not to the original. Clone can be used to
+// prepare common templates and use them with variant definitions for other
+// templates, e.g. per-request partials, by adding the variants after the
+// clone is made.
+func (t *Template) Clone() (*Template, error) {
+	nt := t.copy(nil)
+	nt.init()
+	if t.common == nil {
+		return nt, nil
+	}
+	t.muTmpl.RLock()
+	defer t.muTmpl.RUnlock()
+	for k, v := range t.tmpl {
+		if k == t.name {
+			nt.tmpl[t.name] = nt
+			continue
+		}
+		// The associated templates share nt's common structure.
+		tmpl := v.copy(nt.common)
+		nt.tmpl[k] = tmpl
+	}
+	nt.loader = t.loader
+	nt.option = t.option
+	return nt, nil
+}
+
+// copy returns a shallow copy of t, with common set to the argument.
+func (t *Template) copy(c *common) *Template {
+	return &Template{
+		name:       t.name,
+		Tree:       t.Tree,
+		common:     c,
+		leftDelim:  t.leftDelim,
+		rightDelim: t.rightDelim,
+		escaper:    t.escaper,
+	}
+}
+
+// AddParseTree associates the argument parse tree with the template t,
+// giving it the specified name. If the template has not been defined, this
+// tree becomes its definition. If it has been defined and already has that
+// name, the existing definition is replaced; otherwise a new template is
+// created, defined, and returned.
+func (t *Template) AddParseTree(name string, tree *parse.Tree) (*Template, error) {
+	t.init()
+	nt := t
+	if name != t.name {
+		nt = t.New(name)
+	}
+	nt.Tree = tree
+	t.muTmpl.Lock()
+	t.tmpl[name] = nt
+	t.gen.Add(1)
+	t.muTmpl.Unlock()
+	return nt, nil
+}
+
+// Lookup returns the template with the given name that is associated with
+// t. It returns nil if there is no such template or the template has no
+// definition.
+func (t *Template) Lookup(name string) *Template {
+	if t.common == nil {
+		return nil
+	}
+	t.muTmpl.RLock()
+	defer t.muTmpl.RUnlock()
+	return t.tmpl[name]
+}
+
+// Templates returns a slice of defined templates associated with t,
+// including t itself if it has been defined.
+func (t *Template) Templates() []*Template {
+	if t.common == nil {
+		return nil
+	}
+	// Return a slice so we don't expose the map.
+	t.muTmpl.RLock()
+	defer t.muTmpl.RUnlock()
+	m := make([]*Template, 0, len(t.tmpl))
+	for _, v := range t.tmpl {
+		m = append(m, v)
+	}
+	return m
+}
+
+// init guarantees that t has a valid common structure.
+func (t *Template) init() {
+	if t.common == nil {
+		t.common = &common{
+			tmpl: make(map[string]*Template),
+		}
+	}
+}
+
+// Parse parses text as a Mustache template body for t. If the template has
+// already been defined, its body is replaced.
+func (t *Template) Parse(text string) (*Template, error) {
+	t.init()
+	tree, err := parse.New(t.name).Parse(text, t.leftDelim, t.rightDelim)
+	if err != nil {
+		return nil, err
+	}
+	return t.setTree(tree), nil
+}
+
+// ParseBytes is like Parse, but the template body is held in a byte slice.
+// The bytes are not copied, so they must not be modified afterwards.
+func (t *Template) ParseBytes(text []byte) (*Template, error) {
+	t.init()
+	tree, err := parse.ParseBytes(t.name, text, t.leftDelim, t.rightDelim)
+	if err != nil {
+		return nil, err
+	}
+	return t.setTree(tree), nil
+}
+
+// ParseReader is like Parse, but the template body is read from r. The
+// body is read into a single buffer that is parsed without being copied.
+func (t *Template) ParseReader(r io.Reader) (*Template, error) {
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	return t.ParseBytes(b)
+}
+
+// setTree sets t's parse tree and associates t with its name.
+func (t *Template) setTree(tree *parse.Tree) *Template {
+	t.Tree = tree
+	t.muTmpl.Lock()
+	t.tmpl[t.name] = t
+	t.gen.Add(1)
+	t.muTmpl.Unlock()
+	return t
+}
+
+// Parse creates a new template with the given name and parses text as its
+// body.
+func Parse(name, text string) (*Template, error) {
+	return New(name).Parse(text)
+}
+
+// ParseBytes creates a new template with the given name and parses text as
+// its body. The bytes are not copied, so they must not be modified
+// afterwards.
+func ParseBytes(name string, text []byte) (*Template, error) {
+	return New(name).ParseBytes(text)
+}
+
+// ParseReader creates a new template with the given name and parses the
+// contents of r as its body.
+func ParseReader(name string, r io.Reader) (*Template, error) {
+	return New(name).ParseReader(r)
+}
+
+// Must is a helper that wraps a call to a function returning (*Template,
+// error) and panics if the error is non-nil. It is intended for use in
+// variable initializations such as
+//
+//	var t = rollie.Must(rollie.Parse("name", "text"))
+func Must(t *Template, err error) *Template {
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
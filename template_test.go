@@ -0,0 +1,91 @@
+// Copyright 2014 Joel Scoble (github:mohae). All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package rollie
+
+import (
+	"sort"
+	"testing"
+
+	"github.com/mohae/rollie/parse"
+)
+
+func TestLookup(t *testing.T) {
+	tmpl := Must(New("page").Parse("{{>header}}"))
+	header := Must(tmpl.New("header").Parse("<h1>{{title}}</h1>"))
+	if got := tmpl.Lookup("header"); got != header {
+		t.Errorf("expected header template, got %v", got)
+	}
+	if got := header.Lookup("page"); got != tmpl {
+		t.Errorf("expected page template, got %v", got)
+	}
+	if got := tmpl.Lookup("nope"); got != nil {
+		t.Errorf("expected nil, got %v", got)
+	}
+	if got := new(Template).Lookup("page"); got != nil {
+		t.Errorf("expected nil, got %v", got)
+	}
+}
+
+func TestTemplates(t *testing.T) {
+	tmpl := Must(New("page").Parse("{{>header}}"))
+	Must(tmpl.New("header").Parse("<h1>{{title}}</h1>"))
+	tmpl.New("undefined")
+	var names []string
+	for _, tmpl := range tmpl.Templates() {
+		names = append(names, tmpl.Name())
+	}
+	sort.Strings(names)
+	if len(names) != 2 || names[0] != "header" || names[1] != "page" {
+		t.Errorf("expected [header page], got %v", names)
+	}
+}
+
+func TestAddParseTree(t *testing.T) {
+	tmpl := Must(New("page").Parse("[{{>header}}]"))
+	tree, err := parse.Parse("header", "<h1>{{title}}</h1>", "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	header, err := tmpl.AddParseTree("header", tree)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if header.Name() != "header" || tmpl.Lookup("header") != header {
+		t.Errorf("expected header to be associated with page")
+	}
+	testRender(t, tmpl, pageData, "[<h1>Rollie</h1>]")
+	// Adding a tree with the template's own name redefines it.
+	tree, err = parse.Parse("page", "({{>header}})", "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if nt, _ := tmpl.AddParseTree("page", tree); nt != tmpl {
+		t.Errorf("expected the page template to be redefined")
+	}
+	testRender(t, tmpl, pageData, "(<h1>Rollie</h1>)")
+}
+
+func TestClone(t *testing.T) {
+	tmpl := Must(New("page").Loader(MapLoader{"footer": "<footer/>"}).Parse("{{>header}}{{>footer}}"))
+	Must(tmpl.New("header").Parse("<h1>{{title}}</h1>"))
+	clone, err := tmpl.Clone()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Overriding a partial in the clone doesn't affect the original.
+	Must(clone.New("header").Parse("<h2>{{title}}</h2>"))
+	testRender(t, clone, pageData, "<h2>Rollie</h2><footer/>")
+	testRender(t, tmpl, pageData, "<h1>Rollie</h1><footer/>")
+	if clone.Lookup("page") != clone {
+		t.Error("expected the clone to be associated with itself")
+	}
+	if clone.Lookup("header") == tmpl.Lookup("header") {
+		t.Error("expected the clone to have its own header template")
+	}
+	// Partials loaded by the clone aren't added to the original.
+	if tmpl.Lookup("footer") == clone.Lookup("footer") {
+		t.Error("expected loaded partials to be associated separately")
+	}
+}